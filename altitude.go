@@ -0,0 +1,254 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"context"
+	"math"
+)
+
+// SEA_LEVEL_PRESSURE_PA is standard atmosphere pressure at sea level,
+// used as default reference pressure for altitude calculation.
+const SEA_LEVEL_PRESSURE_PA = 101325.0
+
+// International standard atmosphere constants.
+const (
+	// Temperature at sea level in K (kelvin).
+	isaTemperatureK = 288.15
+	// Temperature lapse rate in K per metre.
+	isaLapseRate = 0.0065
+	// Exponent g*M/(R*L) of barometric formula.
+	isaExponent = 5.25588
+	// Celsius to kelvin offset.
+	kelvinOffset = 273.15
+	// Specific gas constant of dry air in J/(kg*K).
+	dryAirGasConstant = 287.05
+	// Standard gravity in m/s^2.
+	standardGravity = 9.80665
+	// Ratio of water vapour and dry air molar masses.
+	vaporMassRatio = 0.622
+)
+
+// Altitude calculates altitude in metres from pressure measured and
+// reference pressure at sea level (QNH), both in Pa, according to
+// barometric formula of international standard atmosphere.
+func Altitude(pressure, seaLevel float64) float64 {
+	return isaTemperatureK / isaLapseRate *
+		(1 - math.Pow(pressure/seaLevel, 1/isaExponent))
+}
+
+// SeaLevelPressure calculates reference pressure at sea level (QNH) in Pa,
+// which gives known altitude in metres for pressure measured. It's inverse
+// of Altitude, so it's used to calibrate altimeter at known elevation.
+func SeaLevelPressure(pressure, altitude float64) float64 {
+	return pressure / math.Pow(1-isaLapseRate*altitude/isaTemperatureK, isaExponent)
+}
+
+// ReduceToSeaLevel calculates pressure at sea level in Pa from station
+// pressure in Pa measured at altitude in metres, taking into account
+// actual air temperature in C (celsius) instead of standard one.
+// That's how weather stations report sea level pressure.
+func ReduceToSeaLevel(pressure, altitude, temperature float64) float64 {
+	return pressure * math.Pow(1-isaLapseRate*altitude/
+		(temperature+isaLapseRate*altitude+kelvinOffset), -isaExponent)
+}
+
+// HypsometricAltitude calculates altitude in metres from pressure
+// measured and reference pressure at sea level (QNH), both in Pa,
+// using air temperature in C (celsius) measured along with pressure
+// instead of standard atmosphere one. Use virtual temperature
+// (see VirtualTemperature), if humidity is known.
+func HypsometricAltitude(pressure, seaLevel, temperature float64) float64 {
+	return (math.Pow(seaLevel/pressure, 1/isaExponent) - 1) *
+		(temperature + kelvinOffset) / isaLapseRate
+}
+
+// HypsometricHeight calculates thickness in metres of air layer between
+// reference pressure level and pressure measured, both in Pa, from mean
+// temperature of layer in C (celsius). Result is positive, when pressure
+// measured is below reference one, i.e. sensor is higher.
+func HypsometricHeight(pressure, reference, temperature float64) float64 {
+	return dryAirGasConstant * (temperature + kelvinOffset) / standardGravity *
+		math.Log(reference/pressure)
+}
+
+// saturationVaporPressure calculates saturation vapour pressure
+// in Pa over water at temperature in C (celsius), using Magnus
+// formula with WMO recommended coefficients.
+func saturationVaporPressure(temperature float64) float64 {
+	return 611.2 * math.Exp(17.62*temperature/(243.12+temperature))
+}
+
+// VirtualTemperature calculates virtual temperature in C (celsius):
+// temperature of dry air, which has the same density as moist air
+// at temperature in C, relative humidity in %RH and pressure in Pa.
+func VirtualTemperature(temperature, humidity, pressure float64) float64 {
+	e := humidity / 100 * saturationVaporPressure(temperature)
+	tv := (temperature + kelvinOffset) / (1 - e/pressure*(1-vaporMassRatio))
+	return tv - kelvinOffset
+}
+
+// layerTemperature returns temperature of measurement, which is
+// virtual one, if humidity is measured as well.
+func layerTemperature(m *Measurement) float64 {
+	if m.HumiditySupported {
+		return VirtualTemperature(m.Temperature, m.Humidity, m.Pressure)
+	}
+	return m.Temperature
+}
+
+// SetSeaLevelPressure set reference pressure at sea level (QNH) in Pa,
+// used by altitude calculation. Default one is SEA_LEVEL_PRESSURE_PA.
+func (v *BMP) SetSeaLevelPressure(pressure float64) error {
+	err := checkRange("sea level pressure", pressure, minPressurePa, maxPressureBMP388Pa)
+	if err != nil {
+		return err
+	}
+	v.seaLevel = pressure
+	return nil
+}
+
+// SeaLevelPressure returns reference pressure at sea level (QNH) in Pa.
+func (v *BMP) SeaLevelPressure() float64 {
+	return v.seaLevel
+}
+
+// pressureMeasured reports, whether last conversion measured pressure
+// according to oversampling written to sensor. BMP180 always does.
+func (v *BMP) pressureMeasured() bool {
+	var cfg MeasureConfig
+	switch sensor := v.bmp.(type) {
+	case *SensorBMP280:
+		cfg = sensor.measured
+	case *SensorBME280:
+		cfg = sensor.measured
+	case *SensorBMP388:
+		cfg = sensor.measured
+	default:
+		return true
+	}
+	return cfg.Pressure != OVERSAMPLING_SKIPPED
+}
+
+// readPressure reads temperature and pressure from single measurement.
+func (v *BMP) readPressure(ctx context.Context, accuracy AccuracyMode) (*Measurement, error) {
+	m, err := v.bmp.ReadAll(ctx, v.bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	if !v.pressureMeasured() {
+		return nil, errSkipped("pressure")
+	}
+	return m, nil
+}
+
+// ReadAltitudeMeters reads pressure and calculates altitude in metres
+// relative to reference pressure at sea level (see SetSeaLevelPressure).
+func (v *BMP) ReadAltitudeMeters(accuracy AccuracyMode) (float64, error) {
+	return v.ReadAltitudeMetersContext(context.Background(), accuracy)
+}
+
+// ReadAltitudeMetersContext is ReadAltitudeMeters, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadAltitudeMetersContext(ctx context.Context, accuracy AccuracyMode) (float64, error) {
+	m, err := v.readPressure(ctx, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	return Altitude(m.Pressure, v.seaLevel), nil
+}
+
+// ReadHypsometricAltitude reads pressure and temperature, and calculates
+// altitude in metres relative to reference pressure at sea level (see
+// SetSeaLevelPressure), using hypsometric formula. BME280 humidity is
+// taken into account via virtual temperature.
+func (v *BMP) ReadHypsometricAltitude(accuracy AccuracyMode) (float64, error) {
+	return v.ReadHypsometricAltitudeContext(context.Background(), accuracy)
+}
+
+// ReadHypsometricAltitudeContext is ReadHypsometricAltitude, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadHypsometricAltitudeContext(ctx context.Context, accuracy AccuracyMode) (float64, error) {
+	m, err := v.readPressure(ctx, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	return HypsometricAltitude(m.Pressure, v.seaLevel, layerTemperature(m)), nil
+}
+
+// ReadHypsometricHeight reads pressure and temperature, and calculates
+// height in metres above level with reference pressure in Pa (taken at
+// start point, for instance), using hypsometric formula. BME280 humidity
+// is taken into account via virtual temperature.
+func (v *BMP) ReadHypsometricHeight(accuracy AccuracyMode, reference float64) (float64, error) {
+	return v.ReadHypsometricHeightContext(context.Background(), accuracy, reference)
+}
+
+// ReadHypsometricHeightContext is ReadHypsometricHeight, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadHypsometricHeightContext(ctx context.Context, accuracy AccuracyMode,
+	reference float64) (float64, error) {
+	m, err := v.readPressure(ctx, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	return HypsometricHeight(m.Pressure, reference, layerTemperature(m)), nil
+}
+
+// CalibrateAltitude reads pressure at known elevation in metres and
+// set reference pressure at sea level, so altitude readings start
+// from this elevation. Returns new reference pressure in Pa.
+func (v *BMP) CalibrateAltitude(accuracy AccuracyMode, elevation float64) (float64, error) {
+	return v.CalibrateAltitudeContext(context.Background(), accuracy, elevation)
+}
+
+// CalibrateAltitudeContext is CalibrateAltitude, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) CalibrateAltitudeContext(ctx context.Context, accuracy AccuracyMode,
+	elevation float64) (float64, error) {
+	m, err := v.readPressure(ctx, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	err = v.SetSeaLevelPressure(SeaLevelPressure(m.Pressure, elevation))
+	if err != nil {
+		return 0, err
+	}
+	return v.seaLevel, nil
+}
+
+// ReadSeaLevelPressure reads station pressure and temperature at
+// altitude in metres and reduce pressure to sea level in Pa.
+func (v *BMP) ReadSeaLevelPressure(accuracy AccuracyMode, altitude float64) (float64, error) {
+	return v.ReadSeaLevelPressureContext(context.Background(), accuracy, altitude)
+}
+
+// ReadSeaLevelPressureContext is ReadSeaLevelPressure, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadSeaLevelPressureContext(ctx context.Context, accuracy AccuracyMode,
+	altitude float64) (float64, error) {
+	m, err := v.readPressure(ctx, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	return ReduceToSeaLevel(m.Pressure, altitude, m.Temperature), nil
+}
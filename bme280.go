@@ -23,11 +23,10 @@ package bsbmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
-
-	i2c "github.com/d2r2/go-i2c"
+	"time"
 )
 
 // BME280 sensors memory map
@@ -37,7 +36,7 @@ const (
 	BME280_CTRL_HUM  = 0xF2
 	BME280_STATUS    = 0xF3
 	BME280_CTRL_MEAS = 0xF4
-	BME280_CONFIG    = 0xF5 // TODO: support IIR filter settings
+	BME280_CONFIG    = 0xF5
 	BME280_RESET     = 0xE0
 	// BME280 specific compensation register's blocks
 	BME280_COEF_PART1_START = 0x88
@@ -52,6 +51,18 @@ const (
 	BME280_HUM_OUT_MSB_LSB        = 0xFD
 )
 
+// BME280 standby time in normal mode, indexed by t_sb setting.
+var bme280StandbyTime = []time.Duration{
+	time.Millisecond / 2,
+	62500 * time.Microsecond,
+	125 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1000 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+}
+
 // Unique BME280 calibration coefficients
 type CoeffBME280 struct {
 	// Registers storing unique calibration coefficients.
@@ -153,20 +164,52 @@ func (v *CoeffBME280) dig_H3() uint8 {
 }
 
 func (v *CoeffBME280) dig_H4() int16 {
-	return int16(uint16(v.COEF_E4)<<4 | uint16(v.COEF_E5&0x0F))
+	return int16(int8(v.COEF_E4))<<4 | int16(v.COEF_E5&0x0F)
 }
 
 func (v *CoeffBME280) dig_H5() int16 {
-	return int16(uint16(v.COEF_E6)<<4 | uint16((v.COEF_E5>>4)&0x0F))
+	return int16(int8(v.COEF_E6))<<4 | int16(v.COEF_E5>>4)
 }
 
 func (v *CoeffBME280) dig_H6() int8 {
 	return int8(v.COEF_E7)
 }
 
+// params returns decoded calibration coefficients by name.
+func (v *CoeffBME280) params() map[string]int64 {
+	return map[string]int64{
+		"dig_T1": int64(v.dig_T1()),
+		"dig_T2": int64(v.dig_T2()),
+		"dig_T3": int64(v.dig_T3()),
+		"dig_P1": int64(v.dig_P1()),
+		"dig_P2": int64(v.dig_P2()),
+		"dig_P3": int64(v.dig_P3()),
+		"dig_P4": int64(v.dig_P4()),
+		"dig_P5": int64(v.dig_P5()),
+		"dig_P6": int64(v.dig_P6()),
+		"dig_P7": int64(v.dig_P7()),
+		"dig_P8": int64(v.dig_P8()),
+		"dig_P9": int64(v.dig_P9()),
+		"dig_H1": int64(v.dig_H1()),
+		"dig_H2": int64(v.dig_H2()),
+		"dig_H3": int64(v.dig_H3()),
+		"dig_H4": int64(v.dig_H4()),
+		"dig_H5": int64(v.dig_H5()),
+		"dig_H6": int64(v.dig_H6()),
+	}
+}
+
 // SensorBME280 specific type
 type SensorBME280 struct {
 	Coeff *CoeffBME280
+	// Sensor measures continuously in normal mode
+	normal bool
+	// Oversampling set by SetMeasureConfig, if any
+	config *MeasureConfig
+	// Oversampling applied to latest conversion
+	measured MeasureConfig
+	// Formulas used by ReadAll
+	compensation CompensationMode
 }
 
 // Static cast to verify at compile time
@@ -175,8 +218,8 @@ var _ SensorInterface = &SensorBME280{}
 
 // ReadSensorID reads sensor signature. It may be used for validation,
 // that proper code settings used for sensor data decoding.
-func (v *SensorBME280) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
-	id, err := i2c.ReadRegU8(BME280_ID_REG)
+func (v *SensorBME280) ReadSensorID(bus Bus) (uint8, error) {
+	id, err := bus.ReadRegU8(BME280_ID_REG)
 	if err != nil {
 		return 0, err
 	}
@@ -184,38 +227,26 @@ func (v *SensorBME280) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
 }
 
 // ReadCoefficients reads compensation coefficients, unique for each sensor.
-func (v *SensorBME280) ReadCoefficients(i2c *i2c.I2C) error {
+func (v *SensorBME280) ReadCoefficients(bus Bus) error {
 	// read coefficients #1
-	_, err := i2c.WriteBytes([]byte{BME280_COEF_PART1_START})
-	if err != nil {
-		return err
-	}
 	var coef1 [BME280_COEF_PART1_BYTES]byte
-	err = readDataToStruct(i2c, BME280_COEF_PART1_BYTES,
+	err := readDataToStruct(bus, BME280_COEF_PART1_START, BME280_COEF_PART1_BYTES,
 		binary.LittleEndian, &coef1)
 	if err != nil {
 		return err
 	}
 
 	// read coefficients #2
-	_, err = i2c.WriteBytes([]byte{BME280_COEF_PART2_START})
-	if err != nil {
-		return err
-	}
 	var coef2 [BME280_COEF_PART2_BYTES]byte
-	err = readDataToStruct(i2c, BME280_COEF_PART2_BYTES,
+	err = readDataToStruct(bus, BME280_COEF_PART2_START, BME280_COEF_PART2_BYTES,
 		binary.LittleEndian, &coef2)
 	if err != nil {
 		return err
 	}
 
 	// read coefficients #3
-	_, err = i2c.WriteBytes([]byte{BME280_COEF_PART3_START})
-	if err != nil {
-		return err
-	}
 	var coef3 [BME280_COEF_PART3_BYTES]byte
-	err = readDataToStruct(i2c, BME280_COEF_PART3_BYTES,
+	err = readDataToStruct(bus, BME280_COEF_PART3_START, BME280_COEF_PART3_BYTES,
 		binary.LittleEndian, &coef3)
 	if err != nil {
 		return err
@@ -235,6 +266,15 @@ func (v *SensorBME280) ReadCoefficients(i2c *i2c.I2C) error {
 	return nil
 }
 
+// loadCoefficients reads compensation coefficients only once,
+// then cached values are used. Call ReadCoefficients to reload them.
+func (v *SensorBME280) loadCoefficients(bus Bus) error {
+	if v.Coeff != nil {
+		return nil
+	}
+	return v.ReadCoefficients(bus)
+}
+
 // IsValidCoefficients verify that compensate registers
 // are not empty, and thus are valid.
 func (v *SensorBME280) IsValidCoefficients() error {
@@ -287,9 +327,16 @@ func (v *SensorBME280) IsValidCoefficients() error {
 		if err != nil {
 			return err
 		}
+		// Any single humidity parameter might be zero,
+		// so check them all together.
+		c := v.Coeff
+		err = checkCoefficientBlock([]byte{c.COEF_A1, c.COEF_E1, c.COEF_E2,
+			c.COEF_E3, c.COEF_E4, c.COEF_E5, c.COEF_E6, c.COEF_E7}, "dig_H1..dig_H6")
+		if err != nil {
+			return err
+		}
 	} else {
-		err := errors.New("CoeffBME280 struct does not build")
-		return err
+		return ErrNoCalibration
 	}
 	return nil
 }
@@ -301,16 +348,16 @@ func (v *SensorBME280) RecognizeSignature(signature uint8) (string, error) {
 	case 0x60:
 		return "BME280", nil
 	default:
-		return "", errors.New(fmt.Sprintf("signature 0x%x doesn't belong to BME280 series", signature))
+		return "", &ErrWrongChipID{SensorType: BME280, Expected: []uint8{0x60}, Actual: signature}
 	}
 }
 
 // IsBusy reads register 0xF3 for "busy" flag,
 // according to sensor specification.
-func (v *SensorBME280) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
+func (v *SensorBME280) IsBusy(bus Bus) (busy bool, err error) {
 	// Check flag to know status of calculation, according
 	// to specification about SCO (Start of conversion) flag
-	b, err := i2c.ReadRegU8(BME280_STATUS)
+	b, err := bus.ReadRegU8(BME280_STATUS)
 	if err != nil {
 		return false, err
 	}
@@ -319,6 +366,152 @@ func (v *SensorBME280) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
 	return b != 0, nil
 }
 
+// SetIIRFilter writes IIR filter coefficient to config register,
+// keeping standby time and SPI interface bits intact.
+// Coefficients up to 16 are supported.
+func (v *SensorBME280) SetIIRFilter(bus Bus, filter IIRFilter) error {
+	if filter < IIR_FILTER_OFF || filter > IIR_FILTER_16 {
+		return fmt.Errorf("IIR filter %v is %w by BME280", filter, ErrNotSupported)
+	}
+	ctrl, err := bus.ReadRegU8(BME280_CTRL_MEAS)
+	if err != nil {
+		return err
+	}
+	// Config register writes might be ignored in normal mode,
+	// so go to sleep mode first, then restore normal mode.
+	normal := ctrl&0x3 == 3
+	if normal {
+		err = bus.WriteRegU8(BME280_CTRL_MEAS, ctrl&^0x3)
+		if err != nil {
+			return err
+		}
+	}
+	b, err := bus.ReadRegU8(BME280_CONFIG)
+	if err != nil {
+		return err
+	}
+	b = b&^(0x7<<2) | byte(filter)<<2
+	err = bus.WriteRegU8(BME280_CONFIG, b)
+	if err != nil {
+		return err
+	}
+	if normal {
+		err = bus.WriteRegU8(BME280_CTRL_MEAS, ctrl)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMeasureConfig validates and keeps oversampling settings
+// applied to following conversions.
+func (v *SensorBME280) SetMeasureConfig(bus Bus, config *MeasureConfig) error {
+	if config != nil {
+		err := checkMeasureConfig(BME280, config,
+			[2]Oversampling{OVERSAMPLING_X1, OVERSAMPLING_X16},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_X16},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_X16})
+		if err != nil {
+			return err
+		}
+		c := *config
+		config = &c
+	}
+	v.config = config
+	return nil
+}
+
+// defaultMeasureConfig returns oversampling used, when config is not set:
+// temperature is measured with standard accuracy, pressure - with requested one.
+// Oversampling values are equal to BME280 register codes.
+func (v *SensorBME280) defaultMeasureConfig(accuracy AccuracyMode) MeasureConfig {
+	return MeasureConfig{
+		Temperature: Oversampling(v.getOversamplingRation(ACCURACY_STANDARD)),
+		Pressure:    Oversampling(v.getOversamplingRation(accuracy)),
+		Humidity:    Oversampling(v.getOversamplingRation(ACCURACY_ULTRA_LOW)),
+	}
+}
+
+// getMeasureTime returns maximum measurement time
+// for oversampling settings, according to sensor specification.
+func (v *SensorBME280) getMeasureTime(cfg MeasureConfig) time.Duration {
+	// t_measure,max = 1.25 + 2.3*osrs_t + (2.3*osrs_p + 0.575) + (2.3*osrs_h + 0.575) ms
+	t := 1250 + 2300*cfg.Temperature.getSamples()
+	if cfg.Pressure != OVERSAMPLING_SKIPPED {
+		t += 2300*cfg.Pressure.getSamples() + 575
+	}
+	if cfg.Humidity != OVERSAMPLING_SKIPPED {
+		t += 2300*cfg.Humidity.getSamples() + 575
+	}
+	return time.Duration(t) * time.Microsecond
+}
+
+// SetCompensationMode select formulas used by ReadAll.
+func (v *SensorBME280) SetCompensationMode(mode CompensationMode) error {
+	if mode != COMPENSATION_INTEGER && mode != COMPENSATION_FLOAT64 {
+		return fmt.Errorf("compensation mode %d is %w", mode, ErrNotSupported)
+	}
+	v.compensation = mode
+	return nil
+}
+
+// SetNormalMode configures standby time and oversampling,
+// then switch sensor to normal mode.
+func (v *SensorBME280) SetNormalMode(bus Bus, accuracy AccuracyMode, standby time.Duration) error {
+	// Config register writes might be ignored in normal mode,
+	// so go to sleep mode first.
+	err := v.SetForcedMode(bus)
+	if err != nil {
+		return err
+	}
+	b, err := bus.ReadRegU8(BME280_CONFIG)
+	if err != nil {
+		return err
+	}
+	cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+	v.measured = cfg
+	tsb := selectStandby(bme280StandbyTime, standby)
+	lg.Debugf("t_sb=%v", bme280StandbyTime[tsb])
+	b = b&^(0x7<<5) | tsb<<5
+	err = bus.WriteRegU8(BME280_CONFIG, b)
+	if err != nil {
+		return err
+	}
+	err = bus.WriteRegU8(BME280_CTRL_HUM, byte(cfg.Humidity))
+	if err != nil {
+		return err
+	}
+	var power byte = 3 // Normal mode
+	err = bus.WriteRegU8(BME280_CTRL_MEAS, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+	if err != nil {
+		return err
+	}
+	v.normal = true
+	// Wait for first measurement
+	err = waitForCompletion(context.Background(), v, bus, v.getMeasureTime(cfg))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetForcedMode put sensor to sleep mode, from which
+// every reading start single forced conversion.
+func (v *SensorBME280) SetForcedMode(bus Bus) error {
+	b, err := bus.ReadRegU8(BME280_CTRL_MEAS)
+	if err != nil {
+		return err
+	}
+	var power byte = 0 // Sleep mode
+	err = bus.WriteRegU8(BME280_CTRL_MEAS, b&^0x3|power)
+	if err != nil {
+		return err
+	}
+	v.normal = false
+	return nil
+}
+
 func (v *SensorBME280) getOversamplingRation(accuracy AccuracyMode) byte {
 	var b byte
 	switch accuracy {
@@ -340,18 +533,27 @@ func (v *SensorBME280) getOversamplingRation(accuracy AccuracyMode) byte {
 }
 
 // readUncompTemprature reads uncompensated temprature from sensor.
-func (v *SensorBME280) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = 1 // Forced mode
-	osrt := v.getOversamplingRation(accuracy)
-	err := i2c.WriteRegU8(BME280_CTRL_MEAS, power|(osrt<<5))
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
+func (v *SensorBME280) readUncompTemprature(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	if !v.normal {
+		cfg := selectMeasureConfig(v.config, MeasureConfig{
+			Temperature: Oversampling(v.getOversamplingRation(accuracy)),
+		})
+		v.measured = cfg
+		err := bus.WriteRegU8(BME280_CTRL_HUM, byte(cfg.Humidity))
+		if err != nil {
+			return 0, err
+		}
+		var power byte = 1 // Forced mode
+		err = bus.WriteRegU8(BME280_CTRL_MEAS, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+		if err != nil {
+			return 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, err
+		}
 	}
-	buf, _, err := i2c.ReadRegBytes(BME280_TEMP_OUT_MSB_LSB_XLSB, 3)
+	buf, err := bus.ReadRegBytes(BME280_TEMP_OUT_MSB_LSB_XLSB, 3)
 	if err != nil {
 		return 0, err
 	}
@@ -359,219 +561,381 @@ func (v *SensorBME280) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode)
 	return ut, nil
 }
 
-// readUncompPressure reads uncompensated atmospheric pressure from sensor.
-func (v *SensorBME280) readUncompPressure(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = 1 // Forced mode
-	osrp := v.getOversamplingRation(accuracy)
-	err := i2c.WriteRegU8(BME280_CTRL_MEAS, power|(osrp<<2))
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
+// readUncompTempraturePressureAndHumidity reads temprature, atmospheric
+// pressure and humidity uncompensated values from sensor. All values
+// come from single conversion and read in one burst transaction.
+func (v *SensorBME280) readUncompTempraturePressureAndHumidity(ctx context.Context, bus Bus,
+	accuracy AccuracyMode) (temprature int32, pressure int32, humidity int32, err error) {
+	if !v.normal {
+		// Humidity setting become effective only
+		// after write to BME280_CTRL_MEAS.
+		cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+		v.measured = cfg
+		err = bus.WriteRegU8(BME280_CTRL_HUM, byte(cfg.Humidity))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var power byte = 1 // Forced mode
+		err = bus.WriteRegU8(BME280_CTRL_MEAS, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, 0, 0, err
+		}
 	}
-	buf, _, err := i2c.ReadRegBytes(BME280_PRESS_OUT_MSB_LSB_XLSB, 3)
+	// Burst read 0xF7..0xFE: pressure, temperature, then humidity
+	buf, err := bus.ReadRegBytes(BME280_PRESS_OUT_MSB_LSB_XLSB, 8)
 	if err != nil {
-		return 0, err
+		return 0, 0, 0, err
 	}
 	up := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	return up, nil
+	ut := int32(buf[3])<<12 + int32(buf[4])<<4 + int32(buf[5]&0xF0)>>4
+	uh := int32(buf[6])<<8 + int32(buf[7])
+	return ut, up, uh, nil
 }
 
-// readUncompHumidity reads uncompensated humidity from sensor.
-func (v *SensorBME280) readUncompHumidity(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = 1 // Forced mode
-	osrt := v.getOversamplingRation(accuracy)
-	err := i2c.WriteRegU8(BME280_CTRL_MEAS, power|(osrt<<5))
+// compensateTemperature calculates temperature in C (celsius) multiplied by 100
+// and t_fine value, which is used for pressure and humidity compensation.
+func (v *CoeffBME280) compensateTemperature(ut int32) (temperature int32, tFine int32, err error) {
+	err = checkRaw("temperature", ut, 20)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	// Specification use 32-bit arithmetic, which silently wraps
+	// around with corrupted coefficients, so 64-bit one is used.
+	x := int64(ut)
+	var1 := ((x>>3 - int64(v.dig_T1())<<1) * int64(v.dig_T2())) >> 11
+	lg.Debugf("var1=%v", var1)
+	var2 := (((x>>4 - int64(v.dig_T1())) * (x>>4 - int64(v.dig_T1()))) >> 12 *
+		int64(v.dig_T3())) >> 14
+	lg.Debugf("var2=%v", var2)
+	fine := var1 + var2
+	lg.Debugf("t_fine=%v", fine)
+	t := (fine*5 + 128) >> 8
+	err = checkRange("temperature", float64(t)/100, minTemperatureC, maxTemperatureC)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	osrh := v.getOversamplingRation(ACCURACY_ULTRA_LOW)
-	err = i2c.WriteRegU8(BME280_CTRL_HUM, osrh)
+	return int32(t), int32(fine), nil
+}
+
+// compensatePressure calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Value tFine must be taken from successful temperature compensation.
+func (v *CoeffBME280) compensatePressure(up int32, tFine int32) (uint32, error) {
+	err := checkRaw("pressure", up, 20)
 	if err != nil {
 		return 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	var1 := int64(tFine) - 128000
+	lg.Debugf("var1=%v", var1)
+	var2 := var1 * var1 * int64(v.dig_P6())
+	lg.Debugf("var2=%v", var2)
+	var2 += (var1 * int64(v.dig_P5())) << 17
+	var2 += int64(v.dig_P4()) << 35
+	lg.Debugf("var2=%v", var2)
+	var1 = (var1*var1*int64(v.dig_P3()))>>8 + (var1*int64(v.dig_P2()))<<12
+	var1, ok := mulInt64(int64(1)<<47+var1, int64(v.dig_P1()))
+	if !ok {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	var1 >>= 33
+	lg.Debugf("var1=%v", var1)
+	if var1 == 0 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p1 := int64(1048576) - int64(up)
+	p1, ok = mulInt64(p1<<31-var2, 3125)
+	if !ok {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p1 /= var1
+	// Intermediate value is Pa scaled by 2^16 (final correction below
+	// shifts it right by 8 to Q24.8), so anything beyond 36-bit
+	// is obviously wrong and might overflow below.
+	if p1 < 0 || p1 > 1<<36 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	var1 = (int64(v.dig_P9()) * (p1 >> 13) * (p1 >> 13)) >> 25
+	var2 = (int64(v.dig_P8()) * p1) >> 19
+	// Pressure in Pa as Q24.8, i.e. multiplied by 256
+	p1 = (p1+var1+var2)>>8 + int64(v.dig_P7())<<4
+	p2 := p1 * 10 / 256
+	err = checkRange("pressure", float64(p2)/10, minPressurePa, maxPressurePa)
 	if err != nil {
 		return 0, err
 	}
-	buf, _, err := i2c.ReadRegBytes(BME280_HUM_OUT_MSB_LSB, 2)
+	return uint32(p2), nil
+}
+
+// compensateHumidity calculates relative humidity in %RH multiplied by 1024.
+// Value tFine must be taken from successful temperature compensation.
+func (v *CoeffBME280) compensateHumidity(uh int32, tFine int32) (uint32, error) {
+	err := checkRaw("humidity", uh, 16)
 	if err != nil {
 		return 0, err
 	}
-	uh := int32(buf[0])<<8 + int32(buf[1])
-	return uh, nil
+	// Specification use 32-bit arithmetic, which silently wraps
+	// around with corrupted coefficients, so 64-bit one is used.
+	var v_x1 int64
+	v_x1 = int64(tFine) - 76800
+	lg.Debugf("v_x1=%v", v_x1)
+
+	v_x1 = ((((int64(uh) << 14) - (int64(v.dig_H4()) << 20) - (int64(v.dig_H5()) * v_x1)) +
+		16384) >> 15) * (((((((v_x1*int64(v.dig_H6()))>>10)*(((v_x1*
+		int64(v.dig_H3()))>>11)+32768))>>10)+2097152)*
+		int64(v.dig_H2()) + 8192) >> 14)
+
+	lg.Debugf("v_x1=%v", v_x1)
+
+	v_x1 = v_x1 - (((((v_x1 >> 15) * (v_x1 >> 15)) >> 7) * int64(v.dig_H1())) >> 4)
+	lg.Debugf("v_x1=%v", v_x1)
+
+	if v_x1 < 0 {
+		v_x1 = 0
+	} else if v_x1 > 419430400 {
+		v_x1 = 419430400
+	}
+	lg.Debugf("v_x1=%v", v_x1)
+	v_x1 = v_x1 >> 12
+	lg.Debugf("v_x1=%v", v_x1)
+	return uint32(v_x1), nil
 }
 
-// readUncompTempratureAndPressure reads temprature and
-// atmospheric uncompensated pressure from sensor.
-// BME280 allows to read temprature and pressure in one cycle,
-// BMP180 - doesn't.
-func (v *SensorBME280) readUncompTempratureAndPressure(i2c *i2c.I2C,
-	accuracy AccuracyMode) (temprature int32, pressure int32, err error) {
-	var power byte = 1 // Forced mode
-	osrt := v.getOversamplingRation(ACCURACY_STANDARD)
-	osrp := v.getOversamplingRation(accuracy)
-	err = i2c.WriteRegU8(BME280_CTRL_MEAS, power|(osrt<<5)|(osrp<<2))
+// compensateTemperatureFloat calculates temperature in C (celsius)
+// and t_fine value, using double precision formulas.
+func (v *CoeffBME280) compensateTemperatureFloat(ut int32) (temperature float64, tFine float64, err error) {
+	err = checkRaw("temperature", ut, 20)
 	if err != nil {
 		return 0, 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	var1 := (float64(ut)/16384 - float64(v.dig_T1())/1024) * float64(v.dig_T2())
+	var2 := (float64(ut)/131072 - float64(v.dig_T1())/8192) *
+		(float64(ut)/131072 - float64(v.dig_T1())/8192) * float64(v.dig_T3())
+	tFine = var1 + var2
+	lg.Debugf("t_fine=%v", tFine)
+	temperature = tFine / 5120
+	err = checkRange("temperature", temperature, minTemperatureC, maxTemperatureC)
 	if err != nil {
 		return 0, 0, err
 	}
-	buf, _, err := i2c.ReadRegBytes(BME280_TEMP_OUT_MSB_LSB_XLSB, 3)
+	return temperature, tFine, nil
+}
+
+// compensatePressureFloat calculates atmospheric pressure
+// in Pa (Pascal), using double precision formulas.
+func (v *CoeffBME280) compensatePressureFloat(up int32, tFine float64) (float64, error) {
+	err := checkRaw("pressure", up, 20)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	ut := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	buf, _, err = i2c.ReadRegBytes(BME280_PRESS_OUT_MSB_LSB_XLSB, 3)
+	var1 := tFine/2 - 64000
+	var2 := var1 * var1 * float64(v.dig_P6()) / 32768
+	var2 += var1 * float64(v.dig_P5()) * 2
+	var2 = var2/4 + float64(v.dig_P4())*65536
+	var1 = (float64(v.dig_P3())*var1*var1/524288 + float64(v.dig_P2())*var1) / 524288
+	var1 = (1 + var1/32768) * float64(v.dig_P1())
+	if var1 == 0 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p := 1048576 - float64(up)
+	p = (p - var2/4096) * 6250 / var1
+	var1 = float64(v.dig_P9()) * p * p / 2147483648
+	var2 = p * float64(v.dig_P8()) / 32768
+	p += (var1 + var2 + float64(v.dig_P7())) / 16
+	err = checkRange("pressure", p, minPressurePa, maxPressurePa)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	up := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	return ut, up, nil
+	return p, nil
+}
+
+// compensateHumidityFloat calculates humidity in %RH,
+// using double precision formulas.
+func (v *CoeffBME280) compensateHumidityFloat(uh int32, tFine float64) (float64, error) {
+	err := checkRaw("humidity", uh, 16)
+	if err != nil {
+		return 0, err
+	}
+	varH := tFine - 76800
+	varH = (float64(uh) - (float64(v.dig_H4())*64 + float64(v.dig_H5())/16384*varH)) *
+		(float64(v.dig_H2()) / 65536 * (1 + float64(v.dig_H6())/67108864*varH*
+			(1+float64(v.dig_H3())/67108864*varH)))
+	varH = varH * (1 - float64(v.dig_H1())*varH/524288)
+	if varH > 100 {
+		varH = 100
+	} else if varH < 0 {
+		varH = 0
+	}
+	return varH, nil
+}
+
+// CompensateBME280 calculates temperature, atmospheric pressure and
+// humidity from uncompensated ADC values and calibration coefficients.
+// Function doesn't access sensor, so it can be used to post-process
+// recorded raw data. Raw values, which don't fit ADC resolution,
+// or give results outside of sensor operating range, are reported
+// as ErrOutOfRange.
+func CompensateBME280(coeff *CoeffBME280, rawT, rawP, rawH int32) (*Measurement, error) {
+	return compensateBME280(coeff, rawT, rawP, rawH, true, true, COMPENSATION_INTEGER)
+}
+
+// CompensateBME280Float is CompensateBME280, which use double
+// precision formulas, so values are returned in full resolution.
+func CompensateBME280Float(coeff *CoeffBME280, rawT, rawP, rawH int32) (*Measurement, error) {
+	return compensateBME280(coeff, rawT, rawP, rawH, true, true, COMPENSATION_FLOAT64)
+}
+
+// compensateBME280 calculates temperature, and pressure with humidity
+// if they are measured, with formulas selected by compensation mode.
+func compensateBME280(coeff *CoeffBME280, rawT, rawP, rawH int32, pressure, humidity bool,
+	mode CompensationMode) (*Measurement, error) {
+	if coeff == nil {
+		return nil, ErrNoCalibration
+	}
+	m := &Measurement{HumiditySupported: humidity}
+	if mode == COMPENSATION_FLOAT64 {
+		t, tFine, err := coeff.compensateTemperatureFloat(rawT)
+		if err != nil {
+			return nil, err
+		}
+		m.Temperature = t
+		if pressure {
+			m.Pressure, err = coeff.compensatePressureFloat(rawP, tFine)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if humidity {
+			m.Humidity, err = coeff.compensateHumidityFloat(rawH, tFine)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	t, tFine, err := coeff.compensateTemperature(rawT)
+	if err != nil {
+		return nil, err
+	}
+	m.Temperature = float64(t) / 100
+	if pressure {
+		p, err := coeff.compensatePressure(rawP, tFine)
+		if err != nil {
+			return nil, err
+		}
+		m.Pressure = float64(p) / 10
+	}
+	if humidity {
+		h, err := coeff.compensateHumidity(rawH, tFine)
+		if err != nil {
+			return nil, err
+		}
+		m.Humidity = float64(h) / 1024
+	}
+	return m, nil
 }
 
 // ReadTemperatureMult100C reads and calculates temrature in C (celsius) multiplied by 100.
 // Multiplication approach allow to keep result as integer number.
-func (v *SensorBME280) ReadTemperatureMult100C(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	ut, err := v.readUncompTemprature(i2c, accuracy)
+func (v *SensorBME280) ReadTemperatureMult100C(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	ut, err := v.readUncompTemprature(ctx, bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
-	err = v.ReadCoefficients(i2c)
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	t, _, err := v.Coeff.compensateTemperature(ut)
 	if err != nil {
 		return 0, err
 	}
-
-	var1 := ((ut>>3 - int32(v.Coeff.dig_T1())<<1) * int32(v.Coeff.dig_T2())) >> 11
-	lg.Debugf("var1=%v", var1)
-	var2 := (((ut>>4 - int32(v.Coeff.dig_T1())) * (ut>>4 - int32(v.Coeff.dig_T1()))) >> 12 *
-		int32(v.Coeff.dig_T3())) >> 14
-	lg.Debugf("var1=%v", var2)
-	tFine := var1 + var2
-	lg.Debugf("t_fine=%v", tFine)
-	t := (tFine*5 + 128) >> 8
 	return t, nil
 }
 
 // ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
 // Multiplication approach allow to keep result as integer number.
-func (v *SensorBME280) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode) (uint32, error) {
-	ut, up, err := v.readUncompTempratureAndPressure(i2c, accuracy)
+func (v *SensorBME280) ReadPressureMult10Pa(ctx context.Context, bus Bus, accuracy AccuracyMode) (uint32, error) {
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return 0, errSkipped("pressure")
+	}
+	ut, up, _, err := v.readUncompTempraturePressureAndHumidity(ctx, bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
 	lg.Debugf("ut=%v, up=%v", ut, up)
 
-	err = v.ReadCoefficients(i2c)
+	err = v.loadCoefficients(bus)
 	if err != nil {
 		return 0, err
 	}
-
-	var01 := ((ut>>3 - int32(v.Coeff.dig_T1())<<1) * int32(v.Coeff.dig_T2())) >> 11
-	lg.Debugf("var01=%v", var01)
-	var02 := (((ut>>4 - int32(v.Coeff.dig_T1())) * (ut>>4 - int32(v.Coeff.dig_T1()))) >> 12 *
-		int32(v.Coeff.dig_T3())) >> 14
-	lg.Debugf("var01=%v", var02)
-	tFine := var01 + var02
-
-	var1 := int64(tFine) - 128000
-	lg.Debugf("var1=%v", var1)
-	var2 := var1 * var1 * int64(v.Coeff.dig_P6())
-	lg.Debugf("var2=%v", var2)
-	var2 += (var1 * int64(v.Coeff.dig_P5())) << 17
-	var2 += int64(v.Coeff.dig_P4()) << 35
-	lg.Debugf("var2=%v", var2)
-	var1 = (var1*var1*int64(v.Coeff.dig_P3()))>>8 + (var1*int64(v.Coeff.dig_P2()))<<12
-	var1 = ((int64(1)<<47 + var1) * int64(v.Coeff.dig_P1())) >> 33
-	lg.Debugf("var1=%v", var1)
-	if var1 == 0 {
-		return 0, nil
+	_, tFine, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
 	}
-	p1 := int64(1048576) - int64(up)
-	p1 = ((p1<<31 - var2) * 3125) / var1
-	var1 = (int64(v.Coeff.dig_P9()) * (p1 >> 13) * (p1 >> 13)) >> 25
-	var2 = (int64(v.Coeff.dig_P8()) * p1) >> 19
-	p1 = (p1+var1+var2)>>8 + int64(v.Coeff.dig_P7())<<4
-	p2 := p1 * 10 / 256
-	p := uint32(p2)
-
-	return p, nil
+	return v.Coeff.compensatePressure(up, tFine)
 }
 
 // ReadHumidityMultQ2210 reads and calculate humidity in %RH.
 // Multiplication approach allow to keep result as integer number.
 // To get real value it's necessary to divide result by 1024.
-func (v *SensorBME280) ReadHumidityMultQ2210(i2c *i2c.I2C,
+func (v *SensorBME280) ReadHumidityMultQ2210(ctx context.Context, bus Bus,
 	accuracy AccuracyMode) (supported bool, humidity uint32, erro error) {
-
-	ut, err := v.readUncompTemprature(i2c, accuracy)
+	if v.config != nil && v.config.Humidity == OVERSAMPLING_SKIPPED {
+		return true, 0, errSkipped("humidity")
+	}
+	ut, _, uh, err := v.readUncompTempraturePressureAndHumidity(ctx, bus, accuracy)
 	if err != nil {
 		return true, 0, err
 	}
-	uh, err := v.readUncompHumidity(i2c, accuracy)
+	lg.Debugf("ut=%v, uh=%v", ut, uh)
+	err = v.loadCoefficients(bus)
 	if err != nil {
 		return true, 0, err
 	}
-	lg.Debugf("ut=%v, uh=%v", ut, uh)
-	err = v.ReadCoefficients(i2c)
+	_, tFine, err := v.Coeff.compensateTemperature(ut)
 	if err != nil {
 		return true, 0, err
 	}
+	h, err := v.Coeff.compensateHumidity(uh, tFine)
+	if err != nil {
+		return true, 0, err
+	}
+	return true, h, nil
+}
 
-	var01 := ((ut>>3 - int32(v.Coeff.dig_T1())<<1) * int32(v.Coeff.dig_T2())) >> 11
-	lg.Debugf("var01=%v", var01)
-	var02 := (((ut>>4 - int32(v.Coeff.dig_T1())) * (ut>>4 - int32(v.Coeff.dig_T1()))) >> 12 *
-		int32(v.Coeff.dig_T3())) >> 14
-	lg.Debugf("var01=%v", var02)
-	tFine := var01 + var02
-	lg.Debugf("t_fine=%v", tFine)
-
-	// Alternative version of humidity calculation from raw value
-	// based on float ariphmetics.
-	//
-	// var var_H float64
-	// var_H = float64(tFine) - 76800.0
-	// var_H = (float64(uh) - ((float64(v.Coeff.dig_H4()))*64.0 + (float64(v.Coeff.dig_H5()))/16384.0*var_H)) *
-	// 	(float64(v.Coeff.dig_H2()) / 65536.0 * (1.0 + (float64(v.Coeff.dig_H6()) / 67108864.0 * var_H *
-	// 		(1.0 + (float64(v.Coeff.dig_H3()) / 67108864.0 * var_H)))))
-	// var_H = var_H * (1.0 - (float64(v.Coeff.dig_H1()) * var_H / 524288.0))
-	// if var_H > 100.0 {
-	// 	var_H = 100.0
-	// }
-	// if var_H < 0.0 {
-	// 	var_H = 0.0
-	// }
-	// return true, uint32(var_H * 1024), nil
-
-	var v_x1 int32
-	v_x1 = tFine - 76800
-	lg.Debugf("v_x1=%v", v_x1)
-
-	v_x1 = ((((uh << 14) - (int32(v.Coeff.dig_H4()) << 20) - (int32(v.Coeff.dig_H5()) * v_x1)) +
-		16384) >> 15) * (((((((v_x1*int32(v.Coeff.dig_H6()))>>10)*(((v_x1*
-		int32(v.Coeff.dig_H3()))>>11)+32768))>>10)+2097152)*
-		int32(v.Coeff.dig_H2()) + 8192) >> 14)
-
-	lg.Debugf("v_x1=%v", v_x1)
+// ReadAll reads temperature, atmospheric pressure
+// and humidity obtained from single conversion.
+func (v *SensorBME280) ReadAll(ctx context.Context, bus Bus, accuracy AccuracyMode) (*Measurement, error) {
+	ut, up, uh, err := v.readUncompTempraturePressureAndHumidity(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("ut=%v, up=%v, uh=%v", ut, up, uh)
 
-	v_x1 = v_x1 - (((((v_x1 >> 15) * (v_x1 >> 15)) >> 7) * int32(v.Coeff.dig_H1())) >> 4)
-	lg.Debugf("v_x1=%v", v_x1)
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return nil, err
+	}
+	pressure := v.measured.Pressure != OVERSAMPLING_SKIPPED
+	humidity := v.measured.Humidity != OVERSAMPLING_SKIPPED
+	return compensateBME280(v.Coeff, ut, up, uh, pressure, humidity, v.compensation)
+}
 
-	if v_x1 < 0 {
-		v_x1 = 0
-	} else if v_x1 > 419430400 {
-		v_x1 = 419430400
+// ReadRaw reads uncompensated temperature, atmospheric
+// pressure and humidity obtained from single conversion.
+func (v *SensorBME280) ReadRaw(ctx context.Context, bus Bus, accuracy AccuracyMode) (*RawMeasurement, error) {
+	ut, up, uh, err := v.readUncompTempraturePressureAndHumidity(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
 	}
-	lg.Debugf("v_x1=%v", v_x1)
-	v_x1 = v_x1 >> 12
-	lg.Debugf("v_x1=%v", v_x1)
-	return true, uint32(v_x1), nil
+	m := &RawMeasurement{
+		Temperature: ut,
+		Pressure:    up,
+		Humidity:    uh,
+		Config:      v.measured,
+	}
+	return m, nil
 }
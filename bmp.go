@@ -30,7 +30,10 @@
 package bsbmp
 
 import (
+	"context"
+	"fmt"
 	"math"
+	"time"
 
 	"github.com/d2r2/go-i2c"
 )
@@ -55,6 +58,26 @@ func (v SensorType) String() string {
 	}
 }
 
+// MarshalText implement encoding.TextMarshaler interface,
+// so sensor type is stored as model name, e.g. in JSON.
+func (v SensorType) MarshalText() ([]byte, error) {
+	if v < BMP180 || v > BMP388 {
+		return nil, fmt.Errorf("sensor type %d is %w", int(v), ErrNotSupported)
+	}
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implement encoding.TextUnmarshaler interface.
+func (v *SensorType) UnmarshalText(text []byte) error {
+	for _, sensorType := range []SensorType{BMP180, BMP280, BME280, BMP388} {
+		if sensorType.String() == string(text) {
+			*v = sensorType
+			return nil
+		}
+	}
+	return fmt.Errorf("sensor type %q is %w", text, ErrNotSupported)
+}
+
 const (
 	// Bosch Sensortec pressure and temperature sensor model BMP180.
 	BMP180 SensorType = iota
@@ -79,49 +102,186 @@ const (
 	ACCURACY_HIGHEST                        // x32 samples - added in BMP388
 )
 
+// Oversampling define amount of samples averaged in single measurement
+// of temperature, pressure or humidity. Skipped channel is not measured.
+type Oversampling int
+
+const (
+	OVERSAMPLING_SKIPPED Oversampling = iota // channel measurement turned off
+	OVERSAMPLING_X1                          // x1 sample
+	OVERSAMPLING_X2                          // x2 samples
+	OVERSAMPLING_X4                          // x4 samples
+	OVERSAMPLING_X8                          // x8 samples
+	OVERSAMPLING_X16                         // x16 samples
+	OVERSAMPLING_X32                         // x32 samples - BMP388 only
+)
+
+// Implement Stringer interface.
+func (v Oversampling) String() string {
+	if v == OVERSAMPLING_SKIPPED {
+		return "skipped"
+	} else if v > OVERSAMPLING_SKIPPED && v <= OVERSAMPLING_X32 {
+		return fmt.Sprintf("x%d", 1<<uint(v-OVERSAMPLING_X1))
+	} else {
+		return "!!! unknown !!!"
+	}
+}
+
+// getSamples returns amount of samples taken, zero if skipped.
+func (v Oversampling) getSamples() int {
+	if v <= OVERSAMPLING_SKIPPED {
+		return 0
+	}
+	return 1 << uint(v-OVERSAMPLING_X1)
+}
+
+// MeasureConfig keeps independent oversampling settings of
+// temperature, pressure and humidity channels. Temperature can't
+// be skipped, since it's required to compensate other values.
+// Allowed ranges depend on sensor:
+//
+//	BMP180 - temperature x1, pressure skipped..x8, humidity skipped;
+//	BMP280 - temperature x1..x16, pressure skipped..x16, humidity skipped;
+//	BME280 - temperature x1..x16, pressure and humidity skipped..x16;
+//	BMP388 - temperature x1..x32, pressure skipped..x32, humidity skipped.
+type MeasureConfig struct {
+	Temperature Oversampling
+	Pressure    Oversampling
+	Humidity    Oversampling
+}
+
+// IIR filter coefficient, which suppress short-term disturbances
+// in pressure and temperature output (door slam, wind and so on).
+// Not applicable for BMP180.
+type IIRFilter int
+
+const (
+	IIR_FILTER_OFF IIRFilter = iota // filter bypass
+	IIR_FILTER_2                    // coefficient 2 (BMP388 coef_1)
+	IIR_FILTER_4                    // coefficient 4 (BMP388 coef_3)
+	IIR_FILTER_8                    // coefficient 8 (BMP388 coef_7)
+	IIR_FILTER_16                   // coefficient 16 (BMP388 coef_15)
+	IIR_FILTER_32                   // BMP388 coef_31
+	IIR_FILTER_64                   // BMP388 coef_63
+	IIR_FILTER_128                  // BMP388 coef_127
+)
+
+// Implement Stringer interface.
+func (v IIRFilter) String() string {
+	if v == IIR_FILTER_OFF {
+		return "off"
+	} else if v > IIR_FILTER_OFF && v <= IIR_FILTER_128 {
+		return fmt.Sprintf("coefficient %d", 1<<uint(v))
+	} else {
+		return "!!! unknown !!!"
+	}
+}
+
+// CompensationMode select formulas used to calculate
+// measured values from raw ADC values.
+type CompensationMode int
+
+const (
+	// Fixed-point formulas: 0.01 C and 0.1 Pa resolution.
+	COMPENSATION_INTEGER CompensationMode = iota
+	// Double precision formulas from datasheet: full resolution.
+	// Not applicable for BMP180.
+	COMPENSATION_FLOAT64
+)
+
+// Measurement keeps temperature, pressure and humidity
+// obtained from the same measurement cycle.
+type Measurement struct {
+	// Temperature in C (celsius).
+	Temperature float64
+	// Atmospheric pressure in Pa (Pascal),
+	// zero if pressure measurement is skipped.
+	Pressure float64
+	// Relative humidity in %RH, valid only if HumiditySupported is true.
+	// HumiditySupported is false as well, when humidity measurement is skipped.
+	Humidity          float64
+	HumiditySupported bool
+}
+
+// RawMeasurement keeps uncompensated ADC values obtained from the same
+// measurement cycle, together with oversampling applied. Values are
+// 20-bit for BMP280 and BME280 (24-bit for BMP388, 16-19 bit for BMP180
+// pressure depending on oversampling), humidity is 16-bit. Values of
+// skipped channels are meaningless. Pass them to CompensateBMPxxx
+// functions to get compensated measurement.
+type RawMeasurement struct {
+	Temperature int32
+	Pressure    int32
+	// BME280 only.
+	Humidity int32
+	Config   MeasureConfig
+}
+
 // Abstract BMPx sensor interface
 // to control and gather data.
 type SensorInterface interface {
 	// ReadSensorID read sensor identifier unuque for each sensor type.
-	ReadSensorID(i2c *i2c.I2C) (uint8, error)
+	ReadSensorID(bus Bus) (uint8, error)
 	// ReadCoefficients read coefficient's block unique for each sensor.
-	ReadCoefficients(i2c *i2c.I2C) error
+	// Coefficients are cached, so following measurements reuse them.
+	ReadCoefficients(bus Bus) error
 	// IsValidCoefficients verify that coefficient values are not empty.
 	IsValidCoefficients() error
 	// Verify, that specific sensor can own signature identifier and
 	// return text description of this specific id.
 	RecognizeSignature(signature uint8) (string, error)
 	// IsBusy check via status register that sensor ready for data exchange.
-	IsBusy(i2c *i2c.I2C) (bool, error)
+	IsBusy(bus Bus) (bool, error)
+	// SetIIRFilter change IIR filter coefficient used by following measurements.
+	SetIIRFilter(bus Bus, filter IIRFilter) error
+	// SetMeasureConfig change oversampling of separate channels,
+	// nil config return back to settings derived from accuracy.
+	SetMeasureConfig(bus Bus, config *MeasureConfig) error
+	// SetNormalMode start continuous measurements separated by standby time.
+	SetNormalMode(bus Bus, accuracy AccuracyMode, standby time.Duration) error
+	// SetForcedMode stop continuous measurements, so each reading
+	// start separate conversion.
+	SetForcedMode(bus Bus) error
 	// Divide by 10 to get float temperature value in celsius.
-	ReadTemperatureMult100C(i2c *i2c.I2C, mode AccuracyMode) (temperature int32, erro error)
+	ReadTemperatureMult100C(ctx context.Context, bus Bus, mode AccuracyMode) (temperature int32, erro error)
 	// Divide by 10 to get float preasure value in pascal.
-	ReadPressureMult10Pa(i2c *i2c.I2C, mode AccuracyMode) (pressure uint32, erro error)
+	ReadPressureMult10Pa(ctx context.Context, bus Bus, mode AccuracyMode) (pressure uint32, erro error)
 	// Divide by 1024 to get float humidity value in range [0..100]%.
-	ReadHumidityMultQ2210(i2c *i2c.I2C, mode AccuracyMode) (supported bool, humidity uint32, erro error)
+	ReadHumidityMultQ2210(ctx context.Context, bus Bus, mode AccuracyMode) (supported bool, humidity uint32, erro error)
+	// ReadAll reads all values sensor provide from single measurement cycle.
+	ReadAll(ctx context.Context, bus Bus, mode AccuracyMode) (*Measurement, error)
+	// SetCompensationMode select formulas used by ReadAll.
+	SetCompensationMode(mode CompensationMode) error
+	// ReadRaw reads uncompensated values from single measurement cycle.
+	ReadRaw(ctx context.Context, bus Bus, mode AccuracyMode) (*RawMeasurement, error)
 }
 
 // BMP represent both sensors BMP180 and BMP280
 // implementing same approach to control and gather data.
 type BMP struct {
 	sensorType SensorType
-	i2c        *i2c.I2C
+	bus        Bus
 	bmp        SensorInterface
+	// Reference pressure at sea level (QNH) in Pa
+	seaLevel float64
 }
 
-// NewBMP creates new sensor object.
+// NewBMP creates new sensor object connected via i2c-bus.
 func NewBMP(sensorType SensorType, i2c *i2c.I2C) (*BMP, error) {
-	v := &BMP{sensorType: sensorType, i2c: i2c}
-	switch sensorType {
-	case BMP180:
-		v.bmp = &SensorBMP180{}
-	case BMP280:
-		v.bmp = &SensorBMP280{}
-	case BME280:
-		v.bmp = &SensorBME280{}
-	case BMP388:
-		v.bmp = &SensorBMP388{}
+	return NewBMPBus(sensorType, NewI2CBus(i2c))
+}
+
+// NewBMPBus creates new sensor object connected via
+// any transport implementing Bus interface.
+func NewBMPBus(sensorType SensorType, bus Bus) (*BMP, error) {
+	sensor, err := newSensor(sensorType)
+	if err != nil {
+		return nil, err
 	}
+	// Report transport failures as ErrBusIO
+	bus = newCheckedBus(bus)
+	v := &BMP{sensorType: sensorType, bus: bus, bmp: sensor,
+		seaLevel: SEA_LEVEL_PRESSURE_PA}
 
 	id, err := v.ReadSensorID()
 	if err != nil {
@@ -131,17 +291,38 @@ func NewBMP(sensorType SensorType, i2c *i2c.I2C) (*BMP, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = v.bmp.ReadCoefficients(i2c)
+	err = v.bmp.ReadCoefficients(bus)
 	if err != nil {
 		return nil, err
 	}
 	return v, nil
 }
 
+// newSensor creates sensor specific object.
+func newSensor(sensorType SensorType) (SensorInterface, error) {
+	switch sensorType {
+	case BMP180:
+		return &SensorBMP180{}, nil
+	case BMP280:
+		return &SensorBMP280{}, nil
+	case BME280:
+		return &SensorBME280{}, nil
+	case BMP388:
+		return &SensorBMP388{}, nil
+	default:
+		return nil, fmt.Errorf("sensor type %v is %w", sensorType, ErrNotSupported)
+	}
+}
+
+// SensorType returns model of sensor.
+func (v *BMP) SensorType() SensorType {
+	return v.sensorType
+}
+
 // ReadSensorID reads sensor signature. It may be used for validation,
 // that proper code settings used for sensor data decoding.
 func (v *BMP) ReadSensorID() (uint8, error) {
-	id, err := v.bmp.ReadSensorID(v.i2c)
+	id, err := v.bmp.ReadSensorID(v.bus)
 	return id, err
 }
 
@@ -149,16 +330,81 @@ func (v *BMP) IsValidCoefficients() error {
 	return v.bmp.IsValidCoefficients()
 }
 
+// ReloadCoefficients reads calibration coefficients from sensor again
+// and verify they look valid. Coefficients are read once by NewBMP
+// and cached, so reload is needed only if sensor is replaced,
+// or previous read is suspected to be corrupted.
+func (v *BMP) ReloadCoefficients() error {
+	err := v.bmp.ReadCoefficients(v.bus)
+	if err != nil {
+		return err
+	}
+	return v.bmp.IsValidCoefficients()
+}
+
+// SetIIRFilter change IIR filter coefficient applied to pressure
+// and temperature readings. Setting is kept until changed again.
+func (v *BMP) SetIIRFilter(filter IIRFilter) error {
+	return v.bmp.SetIIRFilter(v.bus, filter)
+}
+
+// SetMeasureConfig set oversampling of temperature, pressure and humidity
+// independently, which allows to follow Bosch recommended settings.
+// Once set, config overrides accuracy passed to Read... and SetNormalMode
+// methods. Pass nil to return back to settings derived from accuracy.
+// In normal mode new config is applied by next SetNormalMode call.
+func (v *BMP) SetMeasureConfig(config *MeasureConfig) error {
+	return v.bmp.SetMeasureConfig(v.bus, config)
+}
+
+// SetCompensationMode select either integer (default) or float64
+// compensation formulas used by ReadAll. Float64 formulas return
+// values in full resolution, which is useful for altimetry.
+// Read...Mult... methods always use integer formulas.
+func (v *BMP) SetCompensationMode(mode CompensationMode) error {
+	return v.bmp.SetCompensationMode(mode)
+}
+
+// SetNormalMode switch sensor to normal power mode, when sensor
+// perform measurements continuously, with standby (inactive) time
+// in between. Longest standby time supported by sensor, which doesn't
+// exceed requested one, is selected. BMP388 doesn't have standby setting,
+// so standby is treated as sampling period there (output data rate).
+// In normal mode Read... methods return latest measured data without
+// triggering conversion, and accuracy passed to them is ignored.
+func (v *BMP) SetNormalMode(accuracy AccuracyMode, standby time.Duration) error {
+	return v.bmp.SetNormalMode(v.bus, accuracy, standby)
+}
+
+// SetForcedMode switch sensor back to default forced mode,
+// when each reading triggers single conversion, after
+// which sensor goes to sleep.
+func (v *BMP) SetForcedMode() error {
+	return v.bmp.SetForcedMode(v.bus)
+}
+
 // ReadTemperatureMult100C reads and calculates temrature in C (celsius) multiplied by 100.
 // Multiplication approach allow to keep result as integer amount.
 func (v *BMP) ReadTemperatureMult100C(accuracy AccuracyMode) (int32, error) {
-	t, err := v.bmp.ReadTemperatureMult100C(v.i2c, accuracy)
+	return v.ReadTemperatureMult100CContext(context.Background(), accuracy)
+}
+
+// ReadTemperatureMult100CContext is ReadTemperatureMult100C, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadTemperatureMult100CContext(ctx context.Context, accuracy AccuracyMode) (int32, error) {
+	t, err := v.bmp.ReadTemperatureMult100C(ctx, v.bus, accuracy)
 	return t, err
 }
 
 // ReadTemperatureC reads and calculates temrature in C (celsius).
 func (v *BMP) ReadTemperatureC(accuracy AccuracyMode) (float32, error) {
-	t, err := v.bmp.ReadTemperatureMult100C(v.i2c, accuracy)
+	return v.ReadTemperatureCContext(context.Background(), accuracy)
+}
+
+// ReadTemperatureCContext is ReadTemperatureC, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadTemperatureCContext(ctx context.Context, accuracy AccuracyMode) (float32, error) {
+	t, err := v.bmp.ReadTemperatureMult100C(ctx, v.bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
@@ -168,13 +414,25 @@ func (v *BMP) ReadTemperatureC(accuracy AccuracyMode) (float32, error) {
 // ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
 // Multiplication approach allow to keep result as integer amount.
 func (v *BMP) ReadPressureMult10Pa(accuracy AccuracyMode) (uint32, error) {
-	p, err := v.bmp.ReadPressureMult10Pa(v.i2c, accuracy)
+	return v.ReadPressureMult10PaContext(context.Background(), accuracy)
+}
+
+// ReadPressureMult10PaContext is ReadPressureMult10Pa, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadPressureMult10PaContext(ctx context.Context, accuracy AccuracyMode) (uint32, error) {
+	p, err := v.bmp.ReadPressureMult10Pa(ctx, v.bus, accuracy)
 	return p, err
 }
 
 // ReadPressurePa reads and calculates atmospheric pressure in Pa (Pascal).
 func (v *BMP) ReadPressurePa(accuracy AccuracyMode) (float32, error) {
-	p, err := v.bmp.ReadPressureMult10Pa(v.i2c, accuracy)
+	return v.ReadPressurePaContext(context.Background(), accuracy)
+}
+
+// ReadPressurePaContext is ReadPressurePa, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadPressurePaContext(ctx context.Context, accuracy AccuracyMode) (float32, error) {
+	p, err := v.bmp.ReadPressureMult10Pa(ctx, v.bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
@@ -183,20 +441,28 @@ func (v *BMP) ReadPressurePa(accuracy AccuracyMode) (float32, error) {
 
 // ReadPressureMmHg reads and calculates atmospheric pressure in mmHg (millimeter of mercury).
 func (v *BMP) ReadPressureMmHg(accuracy AccuracyMode) (float32, error) {
-	p, err := v.bmp.ReadPressureMult10Pa(v.i2c, accuracy)
+	return v.ReadPressureMmHgContext(context.Background(), accuracy)
+}
+
+// ReadPressureMmHgContext is ReadPressureMmHg, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadPressureMmHgContext(ctx context.Context, accuracy AccuracyMode) (float32, error) {
+	p, err := v.bmp.ReadPressureMult10Pa(ctx, v.bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
-	// Amount of Pa in 1 mmHg
-	var mmHg float32 = 133.322
-	// Round up to 2 decimals after point
-	p2 := float32(int(float32(p)/mmHg*10)) / 100
-	return p2, nil
+	return float32(Pressure(float64(p) / 10).In(PRESSURE_MMHG)), nil
 }
 
 // ReadHumidityRH reads and calculate humidity %RH.
 func (v *BMP) ReadHumidityRH(accuracy AccuracyMode) (bool, float32, error) {
-	supported, h, err := v.bmp.ReadHumidityMultQ2210(v.i2c, accuracy)
+	return v.ReadHumidityRHContext(context.Background(), accuracy)
+}
+
+// ReadHumidityRHContext is ReadHumidityRH, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadHumidityRHContext(ctx context.Context, accuracy AccuracyMode) (bool, float32, error) {
+	supported, h, err := v.bmp.ReadHumidityMultQ2210(ctx, v.bus, accuracy)
 	if !supported {
 		return supported, 0, nil
 	}
@@ -207,15 +473,51 @@ func (v *BMP) ReadHumidityRH(accuracy AccuracyMode) (bool, float32, error) {
 	return supported, h2, nil
 }
 
-// ReadAltitude reads and calculates altitude above sea level, if we assume
-// that pressure at sea level is equal to 101325 Pa.
+// ReadAll reads temperature, pressure and humidity (if supported)
+// with single burst read, so all values belong to the same conversion.
+// It takes less bus transactions, than separate Read... calls.
+func (v *BMP) ReadAll(accuracy AccuracyMode) (*Measurement, error) {
+	return v.ReadAllContext(context.Background(), accuracy)
+}
+
+// ReadAllContext is ReadAll, which stop waiting
+// for conversion, once context is cancelled or expired.
+func (v *BMP) ReadAllContext(ctx context.Context, accuracy AccuracyMode) (*Measurement, error) {
+	return v.bmp.ReadAll(ctx, v.bus, accuracy)
+}
+
+// ReadRaw reads uncompensated ADC values of temperature, pressure
+// and humidity (if supported) for diagnostics or offline compensation.
+func (v *BMP) ReadRaw(accuracy AccuracyMode) (*RawMeasurement, error) {
+	return v.ReadRawContext(context.Background(), accuracy)
+}
+
+// ReadRawContext is ReadRaw, which stop waiting
+// for conversion, once context is cancelled or expired.
+func (v *BMP) ReadRawContext(ctx context.Context, accuracy AccuracyMode) (*RawMeasurement, error) {
+	return v.bmp.ReadRaw(ctx, v.bus, accuracy)
+}
+
+// ReadAltitude reads and calculates altitude above sea level in metres,
+// rounded down to centimetres, with approximate barometric formula
+// 44330*(1-(p/p0)^(1/5.255)). Reference pressure at sea level p0 is equal
+// to 101325 Pa, unless changed by SetSeaLevelPressure or CalibrateAltitude.
+// Use ReadAltitudeMeters to get altitude in full resolution with
+// standard atmosphere constants (see Altitude).
 func (v *BMP) ReadAltitude(accuracy AccuracyMode) (float32, error) {
-	p, err := v.bmp.ReadPressureMult10Pa(v.i2c, accuracy)
+	return v.ReadAltitudeContext(context.Background(), accuracy)
+}
+
+// ReadAltitudeContext is ReadAltitude, which stop
+// waiting for conversion, once context is cancelled or expired.
+func (v *BMP) ReadAltitudeContext(ctx context.Context, accuracy AccuracyMode) (float32, error) {
+	p, err := v.bmp.ReadPressureMult10Pa(ctx, v.bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
-	// Approximate atmospheric pressure at sea level in Pa
-	p0 := 1013250.0
+	// Keep constants of original approximation, so that results
+	// don't change with default reference pressure.
+	p0 := v.seaLevel * 10
 	a := 44330 * (1 - math.Pow(float64(p)/p0, 1/5.255))
 	// Round up to 2 decimals after point
 	a2 := float32(int(a*100)) / 100
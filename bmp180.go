@@ -23,11 +23,10 @@ package bsbmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
-
-	i2c "github.com/d2r2/go-i2c"
+	"time"
 )
 
 // BMP180 sensors memory map
@@ -43,6 +42,18 @@ const (
 	BMP180_OUT_MSB_LSB_XLSB = 0xF6
 )
 
+// BMP180 maximum conversion time of temperature and
+// pressure, the latter indexed by oversampling setting (oss).
+var (
+	bmp180TempMeasureTime  = 4500 * time.Microsecond
+	bmp180PressMeasureTime = []time.Duration{
+		4500 * time.Microsecond,
+		7500 * time.Microsecond,
+		13500 * time.Microsecond,
+		25500 * time.Microsecond,
+	}
+)
+
 // Unique BMP180 calibration coefficients
 type CoeffBMP180 struct {
 	// Registers storing unique calibration coefficients
@@ -114,9 +125,28 @@ func (v *CoeffBMP180) dig_MD() int16 {
 	return int16(uint16(v.COEF_BE)<<8 | uint16(v.COEF_BF))
 }
 
+// params returns decoded calibration coefficients by name.
+func (v *CoeffBMP180) params() map[string]int64 {
+	return map[string]int64{
+		"AC1": int64(v.dig_AC1()),
+		"AC2": int64(v.dig_AC2()),
+		"AC3": int64(v.dig_AC3()),
+		"AC4": int64(v.dig_AC4()),
+		"AC5": int64(v.dig_AC5()),
+		"AC6": int64(v.dig_AC6()),
+		"B1":  int64(v.dig_B1()),
+		"B2":  int64(v.dig_B2()),
+		"MB":  int64(v.dig_MB()),
+		"MC":  int64(v.dig_MC()),
+		"MD":  int64(v.dig_MD()),
+	}
+}
+
 // SensorBMP180 specific type
 type SensorBMP180 struct {
 	Coeff *CoeffBMP180
+	// Oversampling set by SetMeasureConfig, if any
+	config *MeasureConfig
 }
 
 // Static cast to verify at compile time
@@ -125,8 +155,8 @@ var _ SensorInterface = &SensorBMP180{}
 
 // ReadSensorID reads sensor signature. It may be used for validation,
 // that proper code settings used for sensor data decoding.
-func (v *SensorBMP180) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
-	id, err := i2c.ReadRegU8(BMP180_ID_REG)
+func (v *SensorBMP180) ReadSensorID(bus Bus) (uint8, error) {
+	id, err := bus.ReadRegU8(BMP180_ID_REG)
 	if err != nil {
 		return 0, err
 	}
@@ -134,13 +164,9 @@ func (v *SensorBMP180) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
 }
 
 // ReadCoefficients reads compensation coefficients, unique for each sensor.
-func (v *SensorBMP180) ReadCoefficients(i2c *i2c.I2C) error {
-	_, err := i2c.WriteBytes([]byte{BMP180_COEF_START})
-	if err != nil {
-		return err
-	}
+func (v *SensorBMP180) ReadCoefficients(bus Bus) error {
 	var coef1 [BMP180_COEF_BYTES]byte
-	err = readDataToStruct(i2c, BMP180_COEF_BYTES,
+	err := readDataToStruct(bus, BMP180_COEF_START, BMP180_COEF_BYTES,
 		binary.LittleEndian, &coef1)
 	if err != nil {
 		return err
@@ -155,6 +181,15 @@ func (v *SensorBMP180) ReadCoefficients(i2c *i2c.I2C) error {
 	return nil
 }
 
+// loadCoefficients reads compensation coefficients only once,
+// then cached values are used. Call ReadCoefficients to reload them.
+func (v *SensorBMP180) loadCoefficients(bus Bus) error {
+	if v.Coeff != nil {
+		return nil
+	}
+	return v.ReadCoefficients(bus)
+}
+
 // IsValidCoefficients verify that compensate registers
 // are not empty, and thus are valid.
 func (v *SensorBMP180) IsValidCoefficients() error {
@@ -204,8 +239,7 @@ func (v *SensorBMP180) IsValidCoefficients() error {
 			return err
 		}
 	} else {
-		err := errors.New("CoeffBMP180 struct does not built")
-		return err
+		return ErrNoCalibration
 	}
 	return nil
 }
@@ -217,16 +251,16 @@ func (v *SensorBMP180) RecognizeSignature(signature uint8) (string, error) {
 	case 0x55:
 		return "BMP180", nil
 	default:
-		return "", errors.New(fmt.Sprintf("signature 0x%x doesn't belong to BMP180 series", signature))
+		return "", &ErrWrongChipID{SensorType: BMP180, Expected: []uint8{0x55}, Actual: signature}
 	}
 }
 
 // IsBusy reads register 0xF4 for "busy" flag,
 // according to sensor specification.
-func (v *SensorBMP180) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
+func (v *SensorBMP180) IsBusy(bus Bus) (busy bool, err error) {
 	// Check flag to know status of calculation, according
 	// to specification about SCO (Start of conversion) flag
-	b, err := i2c.ReadRegU8(BMP180_CNTR_MEAS_REG)
+	b, err := bus.ReadRegU8(BMP180_CNTR_MEAS_REG)
 	if err != nil {
 		return false, err
 	}
@@ -236,22 +270,75 @@ func (v *SensorBMP180) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
 }
 
 // readUncompTemp reads uncompensated temprature from sensor.
-func (v *SensorBMP180) readUncompTemp(i2c *i2c.I2C) (int32, error) {
-	err := i2c.WriteRegU8(BMP180_CNTR_MEAS_REG, 0x2F)
+func (v *SensorBMP180) readUncompTemp(ctx context.Context, bus Bus) (int32, error) {
+	err := bus.WriteRegU8(BMP180_CNTR_MEAS_REG, 0x2F)
 	if err != nil {
 		return 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	err = waitForCompletion(ctx, v, bus, bmp180TempMeasureTime)
 	if err != nil {
 		return 0, err
 	}
-	w, err := i2c.ReadRegU16BE(BMP180_OUT_MSB_LSB_XLSB)
+	buf, err := bus.ReadRegBytes(BMP180_OUT_MSB_LSB_XLSB, 2)
 	if err != nil {
 		return 0, err
 	}
+	w := getU16BE(buf)
 	return int32(w), nil
 }
 
+// SetIIRFilter returns error. IIR filter is not applicable for BMP180.
+func (v *SensorBMP180) SetIIRFilter(bus Bus, filter IIRFilter) error {
+	return fmt.Errorf("IIR filter is %w by BMP180", ErrNotSupported)
+}
+
+// SetCompensationMode accepts integer mode only, since
+// BMP180 specification gives integer formulas only.
+func (v *SensorBMP180) SetCompensationMode(mode CompensationMode) error {
+	if mode != COMPENSATION_INTEGER {
+		return fmt.Errorf("float64 compensation is %w by BMP180", ErrNotSupported)
+	}
+	return nil
+}
+
+// SetNormalMode returns error. BMP180 supports forced mode only.
+func (v *SensorBMP180) SetNormalMode(bus Bus, accuracy AccuracyMode, standby time.Duration) error {
+	return fmt.Errorf("normal mode is %w by BMP180", ErrNotSupported)
+}
+
+// SetForcedMode does nothing. BMP180 always works in forced mode.
+func (v *SensorBMP180) SetForcedMode(bus Bus) error {
+	return nil
+}
+
+// SetMeasureConfig validates and keeps oversampling settings
+// applied to following conversions. BMP180 doesn't oversample
+// temperature, so only x1 is accepted for temperature channel.
+func (v *SensorBMP180) SetMeasureConfig(bus Bus, config *MeasureConfig) error {
+	if config != nil {
+		err := checkMeasureConfig(BMP180, config,
+			[2]Oversampling{OVERSAMPLING_X1, OVERSAMPLING_X1},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_X8},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_SKIPPED})
+		if err != nil {
+			return err
+		}
+		c := *config
+		config = &c
+	}
+	v.config = config
+	return nil
+}
+
+// getPressureOss returns pressure oversampling setting (oss)
+// taken from config, if any, otherwise derived from accuracy.
+func (v *SensorBMP180) getPressureOss(accuracy AccuracyMode) byte {
+	if v.config != nil && v.config.Pressure != OVERSAMPLING_SKIPPED {
+		return byte(v.config.Pressure - OVERSAMPLING_X1)
+	}
+	return v.getOversamplingRation(accuracy)
+}
+
 func (v *SensorBMP180) getOversamplingRation(accuracy AccuracyMode) byte {
 	var b byte
 	switch accuracy {
@@ -271,18 +358,18 @@ func (v *SensorBMP180) getOversamplingRation(accuracy AccuracyMode) byte {
 }
 
 // readUncompPressure reads atmospheric uncompensated pressure from sensor.
-func (v *SensorBMP180) readUncompPressure(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	oss := v.getOversamplingRation(accuracy)
+func (v *SensorBMP180) readUncompPressure(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	oss := v.getPressureOss(accuracy)
 	lg.Debugf("oss=%v", oss)
-	err := i2c.WriteRegU8(BMP180_CNTR_MEAS_REG, 0x34+(oss<<6))
+	err := bus.WriteRegU8(BMP180_CNTR_MEAS_REG, 0x34+(oss<<6))
 	if err != nil {
 		return 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	err = waitForCompletion(ctx, v, bus, bmp180PressMeasureTime[oss])
 	if err != nil {
 		return 0, err
 	}
-	buf, _, err := i2c.ReadRegBytes(BMP180_OUT_MSB_LSB_XLSB, 3)
+	buf, err := bus.ReadRegBytes(BMP180_OUT_MSB_LSB_XLSB, 3)
 	if err != nil {
 		return 0, err
 	}
@@ -290,98 +377,234 @@ func (v *SensorBMP180) readUncompPressure(i2c *i2c.I2C, accuracy AccuracyMode) (
 	return up, nil
 }
 
-// ReadTemperatureMult100C reads and calculates temprature in C (celsius) multiplied by 100.
-// Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP180) ReadTemperatureMult100C(i2c *i2c.I2C, mode AccuracyMode) (int32, error) {
-	ut, err := v.readUncompTemp(i2c)
+// compensateTemperature calculates temperature in C (celsius) multiplied by 100
+// and b5 value, which is used for pressure compensation. Specification use
+// 32-bit arithmetic, which silently wraps around with corrupted
+// coefficients, so 64-bit one is used instead.
+func (v *CoeffBMP180) compensateTemperature(ut int32) (temperature int32, b5 int32, err error) {
+	err = checkRaw("temperature", ut, 16)
 	if err != nil {
-		return 0, err
-	}
-	err = v.ReadCoefficients(i2c)
-	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	// Calculate temperature according to sensor specification
-	x1 := ((ut - int32(v.Coeff.dig_AC6())) * int32(v.Coeff.dig_AC5())) >> 15
+	x1 := ((int64(ut) - int64(v.dig_AC6())) * int64(v.dig_AC5())) >> 15
 	lg.Debugf("x1=%v", x1)
-	x2 := (int32(v.Coeff.dig_MC()) << 11) / (x1 + int32(v.Coeff.dig_MD()))
+	if x1+int64(v.dig_MD()) == 0 {
+		return 0, 0, errOverflow("temperature", minTemperatureC, maxTemperatureC)
+	}
+	x2 := (int64(v.dig_MC()) << 11) / (x1 + int64(v.dig_MD()))
 	lg.Debugf("x2=%v", x2)
-	b5 := x1 + x2
-	lg.Debugf("b5=%v", b5)
-	t := ((b5 + 8) >> 4) * 10
+	b := x1 + x2
+	lg.Debugf("b5=%v", b)
+	t := ((b + 8) >> 4) * 10
 	lg.Debugf("t=%v", t)
-	return t, nil
-}
-
-// ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
-// Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP180) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode) (uint32, error) {
-	oss := v.getOversamplingRation(accuracy)
-	ut, err := v.readUncompTemp(i2c)
-	if err != nil {
-		return 0, err
-	}
-	lg.Debugf("ut=%v", ut)
-
-	up, err := v.readUncompPressure(i2c, accuracy)
+	err = checkRange("temperature", float64(t)/100, minTemperatureC, maxTemperatureC)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	lg.Debugf("up=%v", up)
+	// Both values are bounded by temperature range check
+	return int32(t), int32(b), nil
+}
 
-	err = v.ReadCoefficients(i2c)
+// compensatePressure calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Value b5 must be taken from successful temperature compensation. Specification
+// use 32-bit arithmetic, which silently wraps around with corrupted
+// coefficients, so 64-bit signed one is used instead.
+func (v *CoeffBMP180) compensatePressure(up int32, b5 int32, oss byte) (uint32, error) {
+	err := checkRaw("pressure", up, 16+uint(oss))
 	if err != nil {
 		return 0, err
 	}
-
 	// Calculate pressure according to sensor specification
-	x1 := ((ut - int32(v.Coeff.dig_AC6())) * int32(v.Coeff.dig_AC5())) >> 15
-	lg.Debugf("x1=%v", x1)
-	x2 := (int32(v.Coeff.dig_MC()) << 11) / (x1 + int32(v.Coeff.dig_MD()))
-	lg.Debugf("x2=%v", x2)
-	b5 := x1 + x2
-	lg.Debugf("b5=%v", b5)
-	b6 := b5 - 4000
+	b6 := int64(b5) - 4000
 	lg.Debugf("b6=%v", b6)
-	x1 = (int32(v.Coeff.dig_B2()) * ((b6 * b6) >> 12)) >> 11
+	x1 := (int64(v.dig_B2()) * ((b6 * b6) >> 12)) >> 11
 	lg.Debugf("x1=%v", x1)
-	x2 = (int32(v.Coeff.dig_AC2()) * b6) >> 11
+	x2 := (int64(v.dig_AC2()) * b6) >> 11
 	lg.Debugf("x2=%v", x2)
 	x3 := x1 + x2
 	lg.Debugf("x3=%v", x3)
-	b3 := (((int32(v.Coeff.dig_AC1())*4 + x3) << uint32(oss)) + 2) / 4
+	b3 := (((int64(v.dig_AC1())*4 + x3) << oss) + 2) / 4
 	lg.Debugf("b3=%v", b3)
-	x1 = (int32(v.Coeff.dig_AC3()) * b6) >> 13
+	x1 = (int64(v.dig_AC3()) * b6) >> 13
 	lg.Debugf("x1=%v", x1)
-	x2 = ((int32(v.Coeff.dig_B1()) * (b6 * b6)) >> 12) >> 16
+	x2 = (int64(v.dig_B1()) * ((b6 * b6) >> 12)) >> 16
 	lg.Debugf("x2=%v", x2)
 	x3 = ((x1 + x2) + 2) >> 2
 	lg.Debugf("x3=%v", x3)
-	b4 := (uint32(v.Coeff.dig_AC4()) * uint32(x3+32768)) >> 15
+	b4 := (int64(v.dig_AC4()) * (x3 + 32768)) >> 15
 	lg.Debugf("b4=%v", b4)
-	b7 := (uint32(up) - uint32(b3)) * (50000 >> uint32(oss))
+	if b4 <= 0 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	b7 := (int64(up) - b3) * (50000 >> oss)
 	lg.Debugf("b7=%v", b7)
-	var p1 int32
+	var p1 int64
 	if b7 < 0x80000000 {
-		p1 = int32((b7 * 2) / b4)
+		p1 = (b7 * 2) / b4
 	} else {
-		p1 = int32((b7 / b4) * 2)
+		p1 = (b7 / b4) * 2
 	}
 	lg.Debugf("p=%v", p1)
-	x1 = (p1 >> 8) * (p1 >> 8)
-	lg.Debugf("x1=%v", x1)
-	x1 = (x1 * 3038) >> 16
-	lg.Debugf("x1=%v", x1)
-	x2 = (-7357 * p1) >> 16
-	lg.Debugf("x2=%v", x2)
-	p1 += (x1 + x2 + 3791) >> 4
+	// Final correction is small, so anything beyond 24-bit
+	// is obviously wrong and might overflow below.
+	if p1 < 0 || p1 > 1<<24 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	x4 := (p1 >> 8) * (p1 >> 8)
+	x4 = (x4 * 3038) >> 16
+	lg.Debugf("x4=%v", x4)
+	x5 := (-7357 * p1) >> 16
+	lg.Debugf("x5=%v", x5)
+	p1 += (x4 + x5 + 3791) >> 4
 	lg.Debugf("p=%v", p1)
+	err = checkRange("pressure", float64(p1), minPressurePa, maxPressurePa)
+	if err != nil {
+		return 0, err
+	}
 	p := uint32(p1) * 10
 	return p, nil
 }
 
+// CompensateBMP180 calculates temperature and atmospheric pressure
+// from uncompensated ADC values and calibration coefficients. Pressure
+// oversampling, raw pressure was measured with, is required (x1..x8).
+// Function doesn't access sensor, so it can be used to post-process
+// recorded raw data.
+func CompensateBMP180(coeff *CoeffBMP180, rawT, rawP int32,
+	pressure Oversampling) (*Measurement, error) {
+	if coeff == nil {
+		return nil, ErrNoCalibration
+	}
+	if pressure < OVERSAMPLING_X1 || pressure > OVERSAMPLING_X8 {
+		return nil, fmt.Errorf("pressure oversampling %v is %w by BMP180",
+			pressure, ErrNotSupported)
+	}
+	oss := byte(pressure - OVERSAMPLING_X1)
+	t, b5, err := coeff.compensateTemperature(rawT)
+	if err != nil {
+		return nil, err
+	}
+	p, err := coeff.compensatePressure(rawP, b5, oss)
+	if err != nil {
+		return nil, err
+	}
+	m := &Measurement{
+		Temperature: float64(t) / 100,
+		Pressure:    float64(p) / 10,
+	}
+	return m, nil
+}
+
+// ReadTemperatureMult100C reads and calculates temprature in C (celsius) multiplied by 100.
+// Multiplication approach allow to keep result as integer number.
+func (v *SensorBMP180) ReadTemperatureMult100C(ctx context.Context, bus Bus, mode AccuracyMode) (int32, error) {
+	ut, err := v.readUncompTemp(ctx, bus)
+	if err != nil {
+		return 0, err
+	}
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	t, _, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
+	}
+	return t, nil
+}
+
+// ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Multiplication approach allow to keep result as integer number.
+func (v *SensorBMP180) ReadPressureMult10Pa(ctx context.Context, bus Bus, accuracy AccuracyMode) (uint32, error) {
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return 0, errSkipped("pressure")
+	}
+	oss := v.getPressureOss(accuracy)
+	ut, err := v.readUncompTemp(ctx, bus)
+	if err != nil {
+		return 0, err
+	}
+	lg.Debugf("ut=%v", ut)
+
+	up, err := v.readUncompPressure(ctx, bus, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	lg.Debugf("up=%v", up)
+
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	_, b5, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
+	}
+	return v.Coeff.compensatePressure(up, b5, oss)
+}
+
 // ReadHumidityMultQ2210 does nothing. Humidity function is not applicable for BMP180.
-func (v *SensorBMP180) ReadHumidityMultQ2210(i2c *i2c.I2C, accuracy AccuracyMode) (bool, uint32, error) {
+func (v *SensorBMP180) ReadHumidityMultQ2210(ctx context.Context, bus Bus, accuracy AccuracyMode) (bool, uint32, error) {
 	// Not supported
 	return false, 0, nil
 }
+
+// ReadAll reads temperature and atmospheric pressure. BMP180 can't
+// measure both values in one cycle, so two conversions are made
+// one right after another.
+func (v *SensorBMP180) ReadAll(ctx context.Context, bus Bus, accuracy AccuracyMode) (*Measurement, error) {
+	oss := v.getPressureOss(accuracy)
+	ut, err := v.readUncompTemp(ctx, bus)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("ut=%v", ut)
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return nil, err
+	}
+	t, b5, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return nil, err
+	}
+	m := &Measurement{Temperature: float64(t) / 100}
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return m, nil
+	}
+
+	up, err := v.readUncompPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("up=%v", up)
+	p, err := v.Coeff.compensatePressure(up, b5, oss)
+	if err != nil {
+		return nil, err
+	}
+	m.Pressure = float64(p) / 10
+	return m, nil
+}
+
+// ReadRaw reads uncompensated temperature and atmospheric pressure,
+// measured by two conversions one right after another.
+func (v *SensorBMP180) ReadRaw(ctx context.Context, bus Bus, accuracy AccuracyMode) (*RawMeasurement, error) {
+	ut, err := v.readUncompTemp(ctx, bus)
+	if err != nil {
+		return nil, err
+	}
+	m := &RawMeasurement{
+		Temperature: ut,
+		Config:      MeasureConfig{Temperature: OVERSAMPLING_X1},
+	}
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return m, nil
+	}
+	up, err := v.readUncompPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	m.Pressure = up
+	m.Config.Pressure = OVERSAMPLING_X1 + Oversampling(v.getPressureOss(accuracy))
+	return m, nil
+}
@@ -23,11 +23,10 @@ package bsbmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
-
-	i2c "github.com/d2r2/go-i2c"
+	"time"
 )
 
 // BMP280 sensors memory map
@@ -36,7 +35,7 @@ const (
 	BMP280_ID_REG        = 0xD0
 	BMP280_STATUS_REG    = 0xF3
 	BMP280_CNTR_MEAS_REG = 0xF4
-	BMP280_CONFIG        = 0xF5 // TODO: support IIR filter settings
+	BMP280_CONFIG        = 0xF5
 	BMP280_RESET         = 0xE0
 	// BMP280 specific compensation register's block
 	BMP280_COEF_START = 0x88
@@ -46,6 +45,18 @@ const (
 	BMP280_TEMP_OUT_MSB_LSB_XLSB  = 0xFA
 )
 
+// BMP280 standby time in normal mode, indexed by t_sb setting.
+var bmp280StandbyTime = []time.Duration{
+	time.Millisecond / 2,
+	62500 * time.Microsecond,
+	125 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1000 * time.Millisecond,
+	2000 * time.Millisecond,
+	4000 * time.Millisecond,
+}
+
 // Unique BMP280 calibration coefficients
 type CoeffBMP280 struct {
 	// Registers storing unique calibration coefficients
@@ -123,9 +134,35 @@ func (v *CoeffBMP280) dig_P9() int16 {
 	return int16(uint16(v.COEF_9F)<<8 | uint16(v.COEF_9E))
 }
 
+// params returns decoded calibration coefficients by name.
+func (v *CoeffBMP280) params() map[string]int64 {
+	return map[string]int64{
+		"dig_T1": int64(v.dig_T1()),
+		"dig_T2": int64(v.dig_T2()),
+		"dig_T3": int64(v.dig_T3()),
+		"dig_P1": int64(v.dig_P1()),
+		"dig_P2": int64(v.dig_P2()),
+		"dig_P3": int64(v.dig_P3()),
+		"dig_P4": int64(v.dig_P4()),
+		"dig_P5": int64(v.dig_P5()),
+		"dig_P6": int64(v.dig_P6()),
+		"dig_P7": int64(v.dig_P7()),
+		"dig_P8": int64(v.dig_P8()),
+		"dig_P9": int64(v.dig_P9()),
+	}
+}
+
 // SensorBMP280 specific type
 type SensorBMP280 struct {
 	Coeff *CoeffBMP280
+	// Sensor measures continuously in normal mode
+	normal bool
+	// Oversampling set by SetMeasureConfig, if any
+	config *MeasureConfig
+	// Oversampling applied to latest conversion
+	measured MeasureConfig
+	// Formulas used by ReadAll
+	compensation CompensationMode
 }
 
 // Static cast to verify at compile time
@@ -134,8 +171,8 @@ var _ SensorInterface = &SensorBMP280{}
 
 // ReadSensorID reads sensor signature. It may be used for validation,
 // that proper code settings used for sensor data decoding.
-func (v *SensorBMP280) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
-	id, err := i2c.ReadRegU8(BMP280_ID_REG)
+func (v *SensorBMP280) ReadSensorID(bus Bus) (uint8, error) {
+	id, err := bus.ReadRegU8(BMP280_ID_REG)
 	if err != nil {
 		return 0, err
 	}
@@ -143,13 +180,9 @@ func (v *SensorBMP280) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
 }
 
 // ReadCoefficients reads compensation coefficients, unique for each sensor.
-func (v *SensorBMP280) ReadCoefficients(i2c *i2c.I2C) error {
-	_, err := i2c.WriteBytes([]byte{BMP280_COEF_START})
-	if err != nil {
-		return err
-	}
+func (v *SensorBMP280) ReadCoefficients(bus Bus) error {
 	var coef1 [BMP280_COEF_BYTES]byte
-	err = readDataToStruct(i2c, BMP280_COEF_BYTES,
+	err := readDataToStruct(bus, BMP280_COEF_START, BMP280_COEF_BYTES,
 		binary.LittleEndian, &coef1)
 	if err != nil {
 		return err
@@ -164,6 +197,15 @@ func (v *SensorBMP280) ReadCoefficients(i2c *i2c.I2C) error {
 	return nil
 }
 
+// loadCoefficients reads compensation coefficients only once,
+// then cached values are used. Call ReadCoefficients to reload them.
+func (v *SensorBMP280) loadCoefficients(bus Bus) error {
+	if v.Coeff != nil {
+		return nil
+	}
+	return v.ReadCoefficients(bus)
+}
+
 // IsValidCoefficients verify that compensate registers
 // are not empty, and thus are valid.
 func (v *SensorBMP280) IsValidCoefficients() error {
@@ -217,8 +259,7 @@ func (v *SensorBMP280) IsValidCoefficients() error {
 			return err
 		}
 	} else {
-		err := errors.New("CoeffBMP280 struct does not build")
-		return err
+		return ErrNoCalibration
 	}
 	return nil
 }
@@ -232,16 +273,16 @@ func (v *SensorBMP280) RecognizeSignature(signature uint8) (string, error) {
 	case 0x56, 0x57:
 		return "BMP280 (sample)", nil
 	default:
-		return "", errors.New(fmt.Sprintf("signature 0x%x doesn't belong to BMP280 series", signature))
+		return "", &ErrWrongChipID{SensorType: BMP280, Expected: []uint8{0x56, 0x57, 0x58}, Actual: signature}
 	}
 }
 
 // IsBusy reads register 0xF3 for "busy" flag,
 // according to sensor specification.
-func (v *SensorBMP280) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
+func (v *SensorBMP280) IsBusy(bus Bus) (busy bool, err error) {
 	// Check flag to know status of calculation, according
 	// to specification about SCO (Start of conversion) flag
-	b, err := i2c.ReadRegU8(BMP280_STATUS_REG)
+	b, err := bus.ReadRegU8(BMP280_STATUS_REG)
 	if err != nil {
 		return false, err
 	}
@@ -250,6 +291,144 @@ func (v *SensorBMP280) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
 	return b != 0, nil
 }
 
+// SetIIRFilter writes IIR filter coefficient to config register,
+// keeping standby time and SPI interface bits intact.
+// Coefficients up to 16 are supported.
+func (v *SensorBMP280) SetIIRFilter(bus Bus, filter IIRFilter) error {
+	if filter < IIR_FILTER_OFF || filter > IIR_FILTER_16 {
+		return fmt.Errorf("IIR filter %v is %w by BMP280", filter, ErrNotSupported)
+	}
+	ctrl, err := bus.ReadRegU8(BMP280_CNTR_MEAS_REG)
+	if err != nil {
+		return err
+	}
+	// Config register writes might be ignored in normal mode,
+	// so go to sleep mode first, then restore normal mode.
+	normal := ctrl&0x3 == 3
+	if normal {
+		err = bus.WriteRegU8(BMP280_CNTR_MEAS_REG, ctrl&^0x3)
+		if err != nil {
+			return err
+		}
+	}
+	b, err := bus.ReadRegU8(BMP280_CONFIG)
+	if err != nil {
+		return err
+	}
+	b = b&^(0x7<<2) | byte(filter)<<2
+	err = bus.WriteRegU8(BMP280_CONFIG, b)
+	if err != nil {
+		return err
+	}
+	if normal {
+		err = bus.WriteRegU8(BMP280_CNTR_MEAS_REG, ctrl)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMeasureConfig validates and keeps oversampling settings
+// applied to following conversions.
+func (v *SensorBMP280) SetMeasureConfig(bus Bus, config *MeasureConfig) error {
+	if config != nil {
+		err := checkMeasureConfig(BMP280, config,
+			[2]Oversampling{OVERSAMPLING_X1, OVERSAMPLING_X16},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_X16},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_SKIPPED})
+		if err != nil {
+			return err
+		}
+		c := *config
+		config = &c
+	}
+	v.config = config
+	return nil
+}
+
+// defaultMeasureConfig returns oversampling used, when config is not set:
+// temperature is measured with standard accuracy, pressure - with requested one.
+// Oversampling values are equal to BMP280 register codes.
+func (v *SensorBMP280) defaultMeasureConfig(accuracy AccuracyMode) MeasureConfig {
+	return MeasureConfig{
+		Temperature: Oversampling(v.getOversamplingRation(ACCURACY_STANDARD)),
+		Pressure:    Oversampling(v.getOversamplingRation(accuracy)),
+	}
+}
+
+// getMeasureTime returns maximum measurement time
+// for oversampling settings, according to sensor specification.
+func (v *SensorBMP280) getMeasureTime(cfg MeasureConfig) time.Duration {
+	// t_measure,max = 1.25 + 2.3*osrs_t + (2.3*osrs_p + 0.575) ms
+	t := 1250 + 2300*cfg.Temperature.getSamples()
+	if cfg.Pressure != OVERSAMPLING_SKIPPED {
+		t += 2300*cfg.Pressure.getSamples() + 575
+	}
+	return time.Duration(t) * time.Microsecond
+}
+
+// SetCompensationMode select formulas used by ReadAll.
+func (v *SensorBMP280) SetCompensationMode(mode CompensationMode) error {
+	if mode != COMPENSATION_INTEGER && mode != COMPENSATION_FLOAT64 {
+		return fmt.Errorf("compensation mode %d is %w", mode, ErrNotSupported)
+	}
+	v.compensation = mode
+	return nil
+}
+
+// SetNormalMode configures standby time and oversampling,
+// then switch sensor to normal mode.
+func (v *SensorBMP280) SetNormalMode(bus Bus, accuracy AccuracyMode, standby time.Duration) error {
+	// Config register writes might be ignored in normal mode,
+	// so go to sleep mode first.
+	err := v.SetForcedMode(bus)
+	if err != nil {
+		return err
+	}
+	b, err := bus.ReadRegU8(BMP280_CONFIG)
+	if err != nil {
+		return err
+	}
+	cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+	v.measured = cfg
+	tsb := selectStandby(bmp280StandbyTime, standby)
+	lg.Debugf("t_sb=%v", bmp280StandbyTime[tsb])
+	b = b&^(0x7<<5) | tsb<<5
+	err = bus.WriteRegU8(BMP280_CONFIG, b)
+	if err != nil {
+		return err
+	}
+	var power byte = 3 // Normal mode
+	err = bus.WriteRegU8(BMP280_CNTR_MEAS_REG, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+	if err != nil {
+		return err
+	}
+	v.normal = true
+	// Wait for first measurement
+	err = waitForCompletion(context.Background(), v, bus, v.getMeasureTime(cfg))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetForcedMode put sensor to sleep mode, from which
+// every reading start single forced conversion.
+func (v *SensorBMP280) SetForcedMode(bus Bus) error {
+	b, err := bus.ReadRegU8(BMP280_CNTR_MEAS_REG)
+	if err != nil {
+		return err
+	}
+	var power byte = 0 // Sleep mode
+	err = bus.WriteRegU8(BMP280_CNTR_MEAS_REG, b&^0x3|power)
+	if err != nil {
+		return err
+	}
+	v.normal = false
+	return nil
+}
+
 func (v *SensorBMP280) getOversamplingRation(accuracy AccuracyMode) byte {
 	var b byte
 	switch accuracy {
@@ -271,18 +450,23 @@ func (v *SensorBMP280) getOversamplingRation(accuracy AccuracyMode) byte {
 }
 
 // readUncompTemprature reads uncompensated temprature from sensor.
-func (v *SensorBMP280) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = 1 // Forced mode
-	osrt := v.getOversamplingRation(accuracy)
-	err := i2c.WriteRegU8(BMP280_CNTR_MEAS_REG, power|(osrt<<5))
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
+func (v *SensorBMP280) readUncompTemprature(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	if !v.normal {
+		cfg := selectMeasureConfig(v.config, MeasureConfig{
+			Temperature: Oversampling(v.getOversamplingRation(accuracy)),
+		})
+		v.measured = cfg
+		var power byte = 1 // Forced mode
+		err := bus.WriteRegU8(BMP280_CNTR_MEAS_REG, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+		if err != nil {
+			return 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, err
+		}
 	}
-	buf, _, err := i2c.ReadRegBytes(BMP280_TEMP_OUT_MSB_LSB_XLSB, 3)
+	buf, err := bus.ReadRegBytes(BMP280_TEMP_OUT_MSB_LSB_XLSB, 3)
 	if err != nil {
 		return 0, err
 	}
@@ -290,126 +474,284 @@ func (v *SensorBMP280) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode)
 	return ut, nil
 }
 
-// readUncompPressure reads atmospheric uncompensated pressure from sensor.
-func (v *SensorBMP280) readUncompPressure(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = 1 // Forced mode
-	osrp := v.getOversamplingRation(accuracy)
-	err := i2c.WriteRegU8(BMP280_CNTR_MEAS_REG, power|(osrp<<2))
+// readUncompTempratureAndPressure reads temprature and
+// atmospheric uncompensated pressure from sensor.
+// BMP280 allows to read temprature and pressure in one cycle,
+// BMP180 - doesn't. Both values are read in single burst
+// transaction, so they belong to the same measurement.
+func (v *SensorBMP280) readUncompTempratureAndPressure(ctx context.Context, bus Bus,
+	accuracy AccuracyMode) (temprature int32, pressure int32, err error) {
+	if !v.normal {
+		cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+		v.measured = cfg
+		var power byte = 1 // Forced mode
+		err = bus.WriteRegU8(BMP280_CNTR_MEAS_REG, power|byte(cfg.Temperature)<<5|byte(cfg.Pressure)<<2)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	// Burst read 0xF7..0xFC: pressure, then temperature
+	buf, err := bus.ReadRegBytes(BMP280_PRESS_OUT_MSB_LSB_XLSB, 6)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
+	}
+	up := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
+	ut := int32(buf[3])<<12 + int32(buf[4])<<4 + int32(buf[5]&0xF0)>>4
+	return ut, up, nil
+}
+
+// compensateTemperature calculates temperature in C (celsius) multiplied by 100
+// and t_fine value, which is used for pressure compensation.
+func (v *CoeffBMP280) compensateTemperature(ut int32) (temperature int32, tFine int32, err error) {
+	err = checkRaw("temperature", ut, 20)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Specification use 32-bit arithmetic, which silently wraps
+	// around with corrupted coefficients, so 64-bit one is used.
+	x := int64(ut)
+	var1 := ((x>>3 - int64(v.dig_T1())<<1) * int64(v.dig_T2())) >> 11
+	lg.Debugf("var1=%v", var1)
+	var2 := (((x>>4 - int64(v.dig_T1())) * (x>>4 - int64(v.dig_T1()))) >> 12 *
+		int64(v.dig_T3())) >> 14
+	lg.Debugf("var2=%v", var2)
+	fine := var1 + var2
+	lg.Debugf("t_fine=%v", fine)
+	t := (fine*5 + 128) >> 8
+	err = checkRange("temperature", float64(t)/100, minTemperatureC, maxTemperatureC)
+	if err != nil {
+		return 0, 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	return int32(t), int32(fine), nil
+}
+
+// compensatePressure calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Value tFine must be taken from successful temperature compensation.
+func (v *CoeffBMP280) compensatePressure(up int32, tFine int32) (uint32, error) {
+	err := checkRaw("pressure", up, 20)
 	if err != nil {
 		return 0, err
 	}
-	buf, _, err := i2c.ReadRegBytes(BMP280_PRESS_OUT_MSB_LSB_XLSB, 3)
+	var1 := int64(tFine) - 128000
+	lg.Debugf("var1=%v", var1)
+	var2 := var1 * var1 * int64(v.dig_P6())
+	lg.Debugf("var2=%v", var2)
+	var2 += (var1 * int64(v.dig_P5())) << 17
+	var2 += int64(v.dig_P4()) << 35
+	lg.Debugf("var2=%v", var2)
+	var1 = (var1*var1*int64(v.dig_P3()))>>8 + (var1*int64(v.dig_P2()))<<12
+	var1, ok := mulInt64(int64(1)<<47+var1, int64(v.dig_P1()))
+	if !ok {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	var1 >>= 33
+	lg.Debugf("var1=%v", var1)
+	if var1 == 0 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p1 := int64(1048576) - int64(up)
+	p1, ok = mulInt64(p1<<31-var2, 3125)
+	if !ok {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p1 /= var1
+	// Intermediate value is Pa scaled by 2^16 (final correction below
+	// shifts it right by 8 to Q24.8), so anything beyond 36-bit
+	// is obviously wrong and might overflow below.
+	if p1 < 0 || p1 > 1<<36 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	var1 = (int64(v.dig_P9()) * (p1 >> 13) * (p1 >> 13)) >> 25
+	var2 = (int64(v.dig_P8()) * p1) >> 19
+	// Pressure in Pa as Q24.8, i.e. multiplied by 256
+	p1 = (p1+var1+var2)>>8 + int64(v.dig_P7())<<4
+	p2 := p1 * 10 / 256
+	err = checkRange("pressure", float64(p2)/10, minPressurePa, maxPressurePa)
 	if err != nil {
 		return 0, err
 	}
-	up := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	return up, nil
+	return uint32(p2), nil
 }
 
-// readUncompTempratureAndPressure reads temprature and
-// atmospheric uncompensated pressure from sensor.
-// BMP280 allows to read temprature and pressure in one cycle,
-// BMP180 - doesn't.
-func (v *SensorBMP280) readUncompTempratureAndPressure(i2c *i2c.I2C,
-	accuracy AccuracyMode) (temprature int32, pressure int32, err error) {
-	var power byte = 1 // Forced mode
-	osrt := v.getOversamplingRation(ACCURACY_STANDARD)
-	osrp := v.getOversamplingRation(accuracy)
-	err = i2c.WriteRegU8(BMP280_CNTR_MEAS_REG, power|(osrt<<5)|(osrp<<2))
+// compensateTemperatureFloat calculates temperature in C (celsius)
+// and t_fine value, using double precision formulas.
+func (v *CoeffBMP280) compensateTemperatureFloat(ut int32) (temperature float64, tFine float64, err error) {
+	err = checkRaw("temperature", ut, 20)
 	if err != nil {
 		return 0, 0, err
 	}
-	_, err = waitForCompletion(v, i2c)
+	var1 := (float64(ut)/16384 - float64(v.dig_T1())/1024) * float64(v.dig_T2())
+	var2 := (float64(ut)/131072 - float64(v.dig_T1())/8192) *
+		(float64(ut)/131072 - float64(v.dig_T1())/8192) * float64(v.dig_T3())
+	tFine = var1 + var2
+	lg.Debugf("t_fine=%v", tFine)
+	temperature = tFine / 5120
+	err = checkRange("temperature", temperature, minTemperatureC, maxTemperatureC)
 	if err != nil {
 		return 0, 0, err
 	}
-	buf, _, err := i2c.ReadRegBytes(BMP280_TEMP_OUT_MSB_LSB_XLSB, 3)
+	return temperature, tFine, nil
+}
+
+// compensatePressureFloat calculates atmospheric pressure
+// in Pa (Pascal), using double precision formulas.
+func (v *CoeffBMP280) compensatePressureFloat(up int32, tFine float64) (float64, error) {
+	err := checkRaw("pressure", up, 20)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	ut := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	buf, _, err = i2c.ReadRegBytes(BMP280_PRESS_OUT_MSB_LSB_XLSB, 3)
+	var1 := tFine/2 - 64000
+	var2 := var1 * var1 * float64(v.dig_P6()) / 32768
+	var2 += var1 * float64(v.dig_P5()) * 2
+	var2 = var2/4 + float64(v.dig_P4())*65536
+	var1 = (float64(v.dig_P3())*var1*var1/524288 + float64(v.dig_P2())*var1) / 524288
+	var1 = (1 + var1/32768) * float64(v.dig_P1())
+	if var1 == 0 {
+		return 0, errOverflow("pressure", minPressurePa, maxPressurePa)
+	}
+	p := 1048576 - float64(up)
+	p = (p - var2/4096) * 6250 / var1
+	var1 = float64(v.dig_P9()) * p * p / 2147483648
+	var2 = p * float64(v.dig_P8()) / 32768
+	p += (var1 + var2 + float64(v.dig_P7())) / 16
+	err = checkRange("pressure", p, minPressurePa, maxPressurePa)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	up := int32(buf[0])<<12 + int32(buf[1])<<4 + int32(buf[2]&0xF0)>>4
-	return ut, up, nil
+	return p, nil
+}
+
+// CompensateBMP280 calculates temperature and atmospheric pressure
+// from uncompensated ADC values and calibration coefficients. Function
+// doesn't access sensor, so it can be used to post-process recorded raw data.
+// Raw values, which don't fit ADC resolution, or give results outside
+// of sensor operating range, are reported as ErrOutOfRange.
+func CompensateBMP280(coeff *CoeffBMP280, rawT, rawP int32) (*Measurement, error) {
+	return compensateBMP280(coeff, rawT, rawP, true, COMPENSATION_INTEGER)
+}
+
+// CompensateBMP280Float is CompensateBMP280, which use double
+// precision formulas, so values are returned in full resolution.
+func CompensateBMP280Float(coeff *CoeffBMP280, rawT, rawP int32) (*Measurement, error) {
+	return compensateBMP280(coeff, rawT, rawP, true, COMPENSATION_FLOAT64)
+}
+
+// compensateBMP280 calculates temperature, and pressure if
+// it's measured, with formulas selected by compensation mode.
+func compensateBMP280(coeff *CoeffBMP280, rawT, rawP int32, pressure bool,
+	mode CompensationMode) (*Measurement, error) {
+	if coeff == nil {
+		return nil, ErrNoCalibration
+	}
+	m := &Measurement{}
+	if mode == COMPENSATION_FLOAT64 {
+		t, tFine, err := coeff.compensateTemperatureFloat(rawT)
+		if err != nil {
+			return nil, err
+		}
+		m.Temperature = t
+		if pressure {
+			m.Pressure, err = coeff.compensatePressureFloat(rawP, tFine)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	t, tFine, err := coeff.compensateTemperature(rawT)
+	if err != nil {
+		return nil, err
+	}
+	m.Temperature = float64(t) / 100
+	if pressure {
+		p, err := coeff.compensatePressure(rawP, tFine)
+		if err != nil {
+			return nil, err
+		}
+		m.Pressure = float64(p) / 10
+	}
+	return m, nil
 }
 
 // ReadTemperatureMult100C reads and calculates temrature in C (celsius) multiplied by 100.
 // Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP280) ReadTemperatureMult100C(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	ut, err := v.readUncompTemprature(i2c, accuracy)
+func (v *SensorBMP280) ReadTemperatureMult100C(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	ut, err := v.readUncompTemprature(ctx, bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
-	err = v.ReadCoefficients(i2c)
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	t, _, err := v.Coeff.compensateTemperature(ut)
 	if err != nil {
 		return 0, err
 	}
-
-	var1 := ((ut>>3 - int32(v.Coeff.dig_T1())<<1) * int32(v.Coeff.dig_T2())) >> 11
-	lg.Debugf("var1=%v", var1)
-	var2 := (((ut>>4 - int32(v.Coeff.dig_T1())) * (ut>>4 - int32(v.Coeff.dig_T1()))) >> 12 *
-		int32(v.Coeff.dig_T3())) >> 14
-	lg.Debugf("var1=%v", var2)
-	tFine := var1 + var2
-	lg.Debugf("t_fine=%v", tFine)
-	t := (tFine*5 + 128) >> 8
 	return t, nil
 }
 
 // ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
 // Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP280) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode) (uint32, error) {
-	ut, up, err := v.readUncompTempratureAndPressure(i2c, accuracy)
+func (v *SensorBMP280) ReadPressureMult10Pa(ctx context.Context, bus Bus, accuracy AccuracyMode) (uint32, error) {
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return 0, errSkipped("pressure")
+	}
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
 	if err != nil {
 		return 0, err
 	}
 	lg.Debugf("ut=%v, up=%v", ut, up)
 
-	err = v.ReadCoefficients(i2c)
+	err = v.loadCoefficients(bus)
 	if err != nil {
 		return 0, err
 	}
-
-	var01 := ((ut>>3 - int32(v.Coeff.dig_T1())<<1) * int32(v.Coeff.dig_T2())) >> 11
-	lg.Debugf("var01=%v", var01)
-	var02 := (((ut>>4 - int32(v.Coeff.dig_T1())) * (ut>>4 - int32(v.Coeff.dig_T1()))) >> 12 *
-		int32(v.Coeff.dig_T3())) >> 14
-	lg.Debugf("var01=%v", var02)
-	tFine := var01 + var02
-
-	var1 := int64(tFine) - 128000
-	lg.Debugf("var1=%v", var1)
-	var2 := var1 * var1 * int64(v.Coeff.dig_P6())
-	lg.Debugf("var2=%v", var2)
-	var2 += (var1 * int64(v.Coeff.dig_P5())) << 17
-	var2 += int64(v.Coeff.dig_P4()) << 35
-	lg.Debugf("var2=%v", var2)
-	var1 = (var1*var1*int64(v.Coeff.dig_P3()))>>8 + (var1*int64(v.Coeff.dig_P2()))<<12
-	var1 = ((int64(1)<<47 + var1) * int64(v.Coeff.dig_P1())) >> 33
-	lg.Debugf("var1=%v", var1)
-	if var1 == 0 {
-		return 0, nil
+	_, tFine, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
 	}
-	p1 := int64(1048576) - int64(up)
-	p1 = ((p1<<31 - var2) * 3125) / var1
-	var1 = (int64(v.Coeff.dig_P9()) * (p1 >> 13) * (p1 >> 13)) >> 25
-	var2 = (int64(v.Coeff.dig_P8()) * p1) >> 19
-	p1 = (p1+var1+var2)>>8 + int64(v.Coeff.dig_P7())<<4
-	p2 := p1 * 10 / 256
-	p := uint32(p2)
-
-	return p, nil
+	return v.Coeff.compensatePressure(up, tFine)
 }
 
 // ReadHumidityMultQ2210 does nothing. Humidity function is not applicable for BMP280.
-func (v *SensorBMP280) ReadHumidityMultQ2210(i2c *i2c.I2C, accuracy AccuracyMode) (bool, uint32, error) {
+func (v *SensorBMP280) ReadHumidityMultQ2210(ctx context.Context, bus Bus, accuracy AccuracyMode) (bool, uint32, error) {
 	// Not supported
 	return false, 0, nil
 }
+
+// ReadAll reads temperature and atmospheric pressure
+// obtained from single conversion.
+func (v *SensorBMP280) ReadAll(ctx context.Context, bus Bus, accuracy AccuracyMode) (*Measurement, error) {
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("ut=%v, up=%v", ut, up)
+
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return nil, err
+	}
+	pressure := v.measured.Pressure != OVERSAMPLING_SKIPPED
+	return compensateBMP280(v.Coeff, ut, up, pressure, v.compensation)
+}
+
+// ReadRaw reads uncompensated temperature and atmospheric
+// pressure obtained from single conversion.
+func (v *SensorBMP280) ReadRaw(ctx context.Context, bus Bus, accuracy AccuracyMode) (*RawMeasurement, error) {
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	m := &RawMeasurement{
+		Temperature: ut,
+		Pressure:    up,
+		Config:      v.measured,
+	}
+	return m, nil
+}
@@ -24,11 +24,11 @@ package bsbmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
-
-	i2c "github.com/d2r2/go-i2c"
+	"math"
+	"time"
 )
 
 // BMP388 sensors memory map
@@ -39,10 +39,10 @@ const (
 	BMP388_ERR_REG    = 0x02
 	//	BMP388_CNTR_MEAS_REG = 0xF4  // No such reg in BMP388
 	BMP388_ODR_REG      = 0x1D // Data Rate control
-	BMP388_OSR_REG      = 0x1D // Over sample rate control
+	BMP388_OSR_REG      = 0x1C // Over sample rate control
 	BMP388_PWR_CTRL_REG = 0x1B // enable/disable press or temp, set operating mode
 	// CONFIG Register is used to set IIR Filter coefficent
-	BMP388_CONFIG = 0x1F // TODO: support IIR filter settings
+	BMP388_CONFIG = 0x1F
 	//	BMP388_RESET         = 0xE0 // TODO: '388 doesn't have a reset register
 	BMP388_CMD_REG = 0x7E
 	//  cmds - nop, extmode, clear FIFO, softreset
@@ -57,15 +57,18 @@ const (
 	BMP388_PWR_MODE_FORCED = 1
 	BMP388_PWR_MODE_NORMAL = 3
 
+	// Configuration error flag of BMP388_ERR_REG
+	BMP388_ERR_CONF = 0x04
+
 	// IIR Filter coefficent
 	BMP388_coef_0   = 0 // bypass-mode
-	BMP388_coef_1   = 0
-	BMP388_coef_3   = 0
-	BMP388_coef_7   = 0
-	BMP388_coef_15  = 0
-	BMP388_coef_31  = 0
-	BMP388_coef_63  = 0
-	BMP388_coef_127 = 0
+	BMP388_coef_1   = 1
+	BMP388_coef_3   = 2
+	BMP388_coef_7   = 3
+	BMP388_coef_15  = 4
+	BMP388_coef_31  = 5
+	BMP388_coef_63  = 6
+	BMP388_coef_127 = 7
 )
 
 // Unique BMP388 calibration coefficients
@@ -150,9 +153,42 @@ func (v *CoeffBMP388) PAR_P11() int8 {
 	return int8(uint16(v.COEF_45))
 }
 
+// params returns decoded calibration coefficients by name.
+func (v *CoeffBMP388) params() map[string]int64 {
+	return map[string]int64{
+		"PAR_T1":  int64(v.PAR_T1()),
+		"PAR_T2":  int64(v.PAR_T2()),
+		"PAR_T3":  int64(v.PAR_T3()),
+		"PAR_P1":  int64(v.PAR_P1()),
+		"PAR_P2":  int64(v.PAR_P2()),
+		"PAR_P3":  int64(v.PAR_P3()),
+		"PAR_P4":  int64(v.PAR_P4()),
+		"PAR_P5":  int64(v.PAR_P5()),
+		"PAR_P6":  int64(v.PAR_P6()),
+		"PAR_P7":  int64(v.PAR_P7()),
+		"PAR_P8":  int64(v.PAR_P8()),
+		"PAR_P9":  int64(v.PAR_P9()),
+		"PAR_P10": int64(v.PAR_P10()),
+		"PAR_P11": int64(v.PAR_P11()),
+	}
+}
+
 // SensorBMP388 specific type
 type SensorBMP388 struct {
 	Coeff *CoeffBMP388
+	// IIR filter coefficient written to config
+	// register before each measurement
+	filter IIRFilter
+	// Sensor measures continuously in normal mode
+	normal bool
+	// Oversampling set by SetMeasureConfig, if any
+	config *MeasureConfig
+	// Oversampling applied to latest conversion
+	measured MeasureConfig
+	// Formulas used by ReadAll
+	compensation CompensationMode
+	// FIFO settings, if FIFO is enabled
+	fifo *FIFOConfigBMP388
 }
 
 // Static cast to verify at compile time
@@ -161,8 +197,8 @@ var _ SensorInterface = &SensorBMP388{}
 
 // ReadSensorID reads sensor signature. It may be used for validation,
 // that proper code settings used for sensor data decoding.
-func (v *SensorBMP388) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
-	id, err := i2c.ReadRegU8(BMP388_ID_REG)
+func (v *SensorBMP388) ReadSensorID(bus Bus) (uint8, error) {
+	id, err := bus.ReadRegU8(BMP388_ID_REG)
 	if err != nil {
 		return 0, err
 	}
@@ -170,13 +206,9 @@ func (v *SensorBMP388) ReadSensorID(i2c *i2c.I2C) (uint8, error) {
 }
 
 // ReadCoefficients reads compensation coefficients, unique for each sensor.
-func (v *SensorBMP388) ReadCoefficients(i2c *i2c.I2C) error {
-	_, err := i2c.WriteBytes([]byte{BMP388_COEF_START})
-	if err != nil {
-		return err
-	}
+func (v *SensorBMP388) ReadCoefficients(bus Bus) error {
 	var coef1 [BMP388_COEF_BYTES]byte
-	err = readDataToStruct(i2c, BMP388_COEF_BYTES,
+	err := readDataToStruct(bus, BMP388_COEF_START, BMP388_COEF_BYTES,
 		binary.LittleEndian, &coef1)
 	if err != nil {
 		return err
@@ -191,20 +223,25 @@ func (v *SensorBMP388) ReadCoefficients(i2c *i2c.I2C) error {
 	return nil
 }
 
-// IsValidCoefficients verify that compensate registers
-// are not empty, and thus are valid.
+// loadCoefficients reads compensation coefficients only once,
+// then cached values are used. Call ReadCoefficients to reload them.
+func (v *SensorBMP388) loadCoefficients(bus Bus) error {
+	if v.Coeff != nil {
+		return nil
+	}
+	return v.ReadCoefficients(bus)
+}
+
+// IsValidCoefficients verify that 16-bit compensate registers
+// are not empty, and thus are valid. 8-bit ones are not verified,
+// since 0 and -1 are legitimate values for them.
 func (v *SensorBMP388) IsValidCoefficients() error {
-	// TODO:  research a better test for valid Coef.  Refeence code doesn't check
 	if v.Coeff != nil {
-		err := checkCoefficient(uint16(v.Coeff.PAR_T1()), "PAR_T1")
+		err := checkCoefficient(v.Coeff.PAR_T1(), "PAR_T1")
 		if err != nil {
 			return err
 		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_T2()), "PAR_T2")
-		if err != nil {
-			return err
-		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_T3()), "PAR_T3")
+		err = checkCoefficient(v.Coeff.PAR_T2(), "PAR_T2")
 		if err != nil {
 			return err
 		}
@@ -216,27 +253,11 @@ func (v *SensorBMP388) IsValidCoefficients() error {
 		if err != nil {
 			return err
 		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P3()), "PAR_P3")
-		if err != nil {
-			return err
-		}
-		//		err = checkCoefficient(uint16(v.Coeff.PAR_P4()), "PAR_P4")
-		//		if err != nil {
-		//			return err
-		//		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P5()), "PAR_P5")
-		if err != nil {
-			return err
-		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P6()), "PAR_P6")
-		if err != nil {
-			return err
-		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P7()), "PAR_P7")
+		err = checkCoefficient(v.Coeff.PAR_P5(), "PAR_P5")
 		if err != nil {
 			return err
 		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P8()), "PAR_P8")
+		err = checkCoefficient(v.Coeff.PAR_P6(), "PAR_P6")
 		if err != nil {
 			return err
 		}
@@ -244,17 +265,8 @@ func (v *SensorBMP388) IsValidCoefficients() error {
 		if err != nil {
 			return err
 		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P10()), "PAR_P10")
-		if err != nil {
-			return err
-		}
-		err = checkCoefficient(uint16(v.Coeff.PAR_P11()), "PAR_P11")
-		if err != nil {
-			return err
-		}
 	} else {
-		err := errors.New("CoeffBMP388 struct does not build")
-		return err
+		return ErrNoCalibration
 	}
 	lg.Debugf("PAR_T1:%v", v.Coeff.PAR_T1())
 	lg.Debugf("PAR_T2:%v", v.Coeff.PAR_T2())
@@ -280,7 +292,7 @@ func (v *SensorBMP388) RecognizeSignature(signature uint8) (string, error) {
 	case 0x50:
 		return "BMP388", nil
 	default:
-		return "", errors.New(fmt.Sprintf("signature 0x%x doesn't belong to BMP388 series", signature))
+		return "", &ErrWrongChipID{SensorType: BMP388, Expected: []uint8{0x50}, Actual: signature}
 	}
 }
 
@@ -291,10 +303,10 @@ func (v *SensorBMP388) RecognizeSignature(signature uint8) (string, error) {
 //    busy/done bit.
 //    for now - we return TRUE when any of the done bits go true
 //   TODO: break out the busy polling
-func (v *SensorBMP388) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
+func (v *SensorBMP388) IsBusy(bus Bus) (busy bool, err error) {
 	// Check flag to know status of calculation, according
 	// to specification about SCO (Start of conversion) flag
-	b, err := i2c.ReadRegU8(BMP388_STATUS_REG)
+	b, err := bus.ReadRegU8(BMP388_STATUS_REG)
 	if err != nil {
 		return false, err
 	}
@@ -303,6 +315,140 @@ func (v *SensorBMP388) IsBusy(i2c *i2c.I2C) (busy bool, err error) {
 	return b == 0, nil
 }
 
+// SetIIRFilter writes IIR filter coefficient to config register.
+// Coefficient is also kept to restore it before each measurement.
+func (v *SensorBMP388) SetIIRFilter(bus Bus, filter IIRFilter) error {
+	if filter < IIR_FILTER_OFF || filter > IIR_FILTER_128 {
+		return fmt.Errorf("IIR filter %v is %w by BMP388", filter, ErrNotSupported)
+	}
+	err := bus.WriteRegU8(BMP388_CONFIG, byte(filter)<<1)
+	if err != nil {
+		return err
+	}
+	v.filter = filter
+	return nil
+}
+
+// SetMeasureConfig validates and keeps oversampling settings
+// applied to following conversions.
+func (v *SensorBMP388) SetMeasureConfig(bus Bus, config *MeasureConfig) error {
+	if config != nil {
+		err := checkMeasureConfig(BMP388, config,
+			[2]Oversampling{OVERSAMPLING_X1, OVERSAMPLING_X32},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_X32},
+			[2]Oversampling{OVERSAMPLING_SKIPPED, OVERSAMPLING_SKIPPED})
+		if err != nil {
+			return err
+		}
+		c := *config
+		config = &c
+	}
+	v.config = config
+	return nil
+}
+
+// defaultMeasureConfig returns oversampling used, when config is not set:
+// temperature is measured with standard accuracy, pressure - with requested one.
+func (v *SensorBMP388) defaultMeasureConfig(accuracy AccuracyMode) MeasureConfig {
+	return MeasureConfig{
+		Temperature: OVERSAMPLING_X1 + Oversampling(v.getOversamplingRation(ACCURACY_STANDARD)),
+		Pressure:    OVERSAMPLING_X1 + Oversampling(v.getOversamplingRation(accuracy)),
+	}
+}
+
+// getOsrAndEnable converts oversampling config to OSR register value
+// and enable bits of PWR_CTRL register. Skipped pressure channel is
+// disabled, since OSR register doesn't have "skipped" code.
+func (v *SensorBMP388) getOsrAndEnable(cfg MeasureConfig) (osr byte, enable byte) {
+	enable = 0x02 // enable temp
+	if cfg.Pressure != OVERSAMPLING_SKIPPED {
+		osr = byte(cfg.Pressure - OVERSAMPLING_X1)
+		enable |= 0x01 // enable pres
+	}
+	osr |= byte(cfg.Temperature-OVERSAMPLING_X1) << 3
+	return osr, enable
+}
+
+// getMeasureTime returns maximum measurement time
+// for oversampling settings, according to sensor specification.
+func (v *SensorBMP388) getMeasureTime(cfg MeasureConfig) time.Duration {
+	// T_conv = 234 + press_en*(392 + 2020*osr_p) + temp_en*(163 + 2020*osr_t) us
+	t := 234 + 163 + 2020*cfg.Temperature.getSamples()
+	if cfg.Pressure != OVERSAMPLING_SKIPPED {
+		t += 392 + 2020*cfg.Pressure.getSamples()
+	}
+	return time.Duration(t) * time.Microsecond
+}
+
+// SetCompensationMode select formulas used by ReadAll.
+func (v *SensorBMP388) SetCompensationMode(mode CompensationMode) error {
+	if mode != COMPENSATION_INTEGER && mode != COMPENSATION_FLOAT64 {
+		return fmt.Errorf("compensation mode %d is %w", mode, ErrNotSupported)
+	}
+	v.compensation = mode
+	return nil
+}
+
+// SetNormalMode configures output data rate and oversampling, then switch
+// sensor to normal mode. Output data rate is selected as 200 Hz divided
+// by power of 2, so that sampling period is longest one not exceeding standby.
+func (v *SensorBMP388) SetNormalMode(bus Bus, accuracy AccuracyMode, standby time.Duration) error {
+	err := v.SetForcedMode(bus)
+	if err != nil {
+		return err
+	}
+	var odr byte
+	for odr < 0x11 && 5*time.Millisecond<<(odr+1) <= standby {
+		odr++
+	}
+	lg.Debugf("odr_sel=%v", odr)
+	err = bus.WriteRegU8(BMP388_ODR_REG, odr)
+	if err != nil {
+		return err
+	}
+	cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+	v.measured = cfg
+	osr, enable := v.getOsrAndEnable(cfg)
+	err = bus.WriteRegU8(BMP388_OSR_REG, osr)
+	if err != nil {
+		return err
+	}
+	var power byte = (BMP388_PWR_MODE_NORMAL << 4) | enable // NORMAL operating mode
+	err = bus.WriteRegU8(BMP388_PWR_CTRL_REG, power)
+	if err != nil {
+		return err
+	}
+	// Sensor reject mode change when measurement
+	// doesn't fit to sampling period
+	b, err := bus.ReadRegU8(BMP388_ERR_REG)
+	if err != nil {
+		return err
+	}
+	if b&BMP388_ERR_CONF != 0 {
+		return fmt.Errorf("sampling period %v is %w by BMP388 for requested accuracy",
+			5*time.Millisecond<<odr, ErrNotSupported)
+	}
+	v.normal = true
+	// Wait for first measurement
+	err = waitForCompletion(context.Background(), v, bus, v.getMeasureTime(cfg))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetForcedMode put sensor to sleep mode, from which
+// every reading start single forced conversion.
+func (v *SensorBMP388) SetForcedMode(bus Bus) error {
+	var power byte = (BMP388_PWR_MODE_SLEEP << 4) | 3 // enable pres, temp, SLEEP operating mode
+	err := bus.WriteRegU8(BMP388_PWR_CTRL_REG, power)
+	if err != nil {
+		return err
+	}
+	v.normal = false
+	return nil
+}
+
 func (v *SensorBMP388) getOversamplingRation(accuracy AccuracyMode) byte {
 	var b byte
 	switch accuracy {
@@ -326,30 +472,37 @@ func (v *SensorBMP388) getOversamplingRation(accuracy AccuracyMode) byte {
 }
 
 // readUncompTemprature reads uncompensated temprature from sensor.
-func (v *SensorBMP388) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	//  set IIR filter to bypass
-	err := i2c.WriteRegU8(BMP388_CONFIG, BMP388_coef_0<<1)
-	if err != nil {
-		return 0, err
-	}
-	//   set over sample rate to 1x
-	osrt := v.getOversamplingRation(accuracy)
-	err = i2c.WriteRegU8(BMP388_OSR_REG, osrt<<3)
-	if err != nil {
-		return 0, err
-	}
-	// enable pres and temp measuremeent, start a measurment
-	var power byte = (BMP388_PWR_MODE_FORCED << 4) | 3 // enable pres, temp, FORCED operating mode
-	lg.Debugf("power=0x%0X", power)
-	err = i2c.WriteRegU8(BMP388_PWR_CTRL_REG, power)
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
+func (v *SensorBMP388) readUncompTemprature(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	if !v.normal {
+		//  set IIR filter coefficient
+		err := bus.WriteRegU8(BMP388_CONFIG, byte(v.filter)<<1)
+		if err != nil {
+			return 0, err
+		}
+		//   set over sample rate
+		cfg := selectMeasureConfig(v.config, MeasureConfig{
+			Temperature: OVERSAMPLING_X1 + Oversampling(v.getOversamplingRation(accuracy)),
+			Pressure:    OVERSAMPLING_X1,
+		})
+		v.measured = cfg
+		osr, enable := v.getOsrAndEnable(cfg)
+		err = bus.WriteRegU8(BMP388_OSR_REG, osr)
+		if err != nil {
+			return 0, err
+		}
+		// enable measuremeent, start a measurment
+		var power byte = (BMP388_PWR_MODE_FORCED << 4) | enable // FORCED operating mode
+		lg.Debugf("power=0x%0X", power)
+		err = bus.WriteRegU8(BMP388_PWR_CTRL_REG, power)
+		if err != nil {
+			return 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, err
+		}
 	}
-	buf, _, err := i2c.ReadRegBytes(BMP388_TEMP_OUT_MSB_LSB_XLSB, 3)
+	buf, err := bus.ReadRegBytes(BMP388_TEMP_OUT_MSB_LSB_XLSB, 3)
 	if err != nil {
 		return 0, err
 	}
@@ -357,93 +510,61 @@ func (v *SensorBMP388) readUncompTemprature(i2c *i2c.I2C, accuracy AccuracyMode)
 	return ut, nil
 }
 
-// readUncompPressure reads atmospheric uncompensated pressure from sensor.
-func (v *SensorBMP388) readUncompPressure(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-	var power byte = (BMP388_PWR_MODE_FORCED << 4) | 3 // enable pres, temp, FORCED operating mode
-	err := i2c.WriteRegU8(BMP388_PWR_CTRL_REG, power)
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
-	}
-	osrp := v.getOversamplingRation(accuracy)
-	err = i2c.WriteRegU8(BMP388_OSR_REG, osrp)
-	if err != nil {
-		return 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, err
-	}
-	buf, _, err := i2c.ReadRegBytes(BMP388_PRES_OUT_MSB_LSB_XLSB, 3)
-	if err != nil {
-		return 0, err
-	}
-	up := int32(buf[0]) + int32(buf[1])<<8 + int32(buf[2])<<16
-	return up, nil
-}
-
 // readUncompTempratureAndPressure reads temprature and
 // atmospheric uncompensated pressure from sensor.
 // BMP388 allows to read temprature and pressure in one cycle,
-// BMP180 - doesn't.
-func (v *SensorBMP388) readUncompTempratureAndPressure(i2c *i2c.I2C,
+// BMP180 - doesn't. Both values are read in single burst
+// transaction, so they belong to the same measurement.
+func (v *SensorBMP388) readUncompTempratureAndPressure(ctx context.Context, bus Bus,
 	accuracy AccuracyMode) (temprature int32, pressure int32, err error) {
-	var power byte = (BMP388_PWR_MODE_FORCED << 4) | 3 // enable pres, temp, FORCED operating mode
-	err = i2c.WriteRegU8(BMP388_PWR_CTRL_REG, power)
-	if err != nil {
-		return 0, 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, 0, err
-	}
-	osrt := v.getOversamplingRation(ACCURACY_STANDARD)
-	osrp := v.getOversamplingRation(accuracy)
-	err = i2c.WriteRegU8(BMP388_OSR_REG, (osrt<<3)|osrp)
-	if err != nil {
-		return 0, 0, err
-	}
-	_, err = waitForCompletion(v, i2c)
-	if err != nil {
-		return 0, 0, err
-	}
-	buf, _, err := i2c.ReadRegBytes(BMP388_TEMP_OUT_MSB_LSB_XLSB, 3)
-	if err != nil {
-		return 0, 0, err
+	if !v.normal {
+		//  set IIR filter coefficient
+		err = bus.WriteRegU8(BMP388_CONFIG, byte(v.filter)<<1)
+		if err != nil {
+			return 0, 0, err
+		}
+		cfg := selectMeasureConfig(v.config, v.defaultMeasureConfig(accuracy))
+		v.measured = cfg
+		osr, enable := v.getOsrAndEnable(cfg)
+		err = bus.WriteRegU8(BMP388_OSR_REG, osr)
+		if err != nil {
+			return 0, 0, err
+		}
+		var power byte = (BMP388_PWR_MODE_FORCED << 4) | enable // FORCED operating mode
+		err = bus.WriteRegU8(BMP388_PWR_CTRL_REG, power)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = waitForCompletion(ctx, v, bus, v.getMeasureTime(cfg))
+		if err != nil {
+			return 0, 0, err
+		}
 	}
-	ut := int32(buf[0]) + int32(buf[1])<<8 + int32(buf[2])<<16
-	buf, _, err = i2c.ReadRegBytes(BMP388_PRES_OUT_MSB_LSB_XLSB, 3)
+	// Burst read 0x04..0x09: pressure, then temperature
+	buf, err := bus.ReadRegBytes(BMP388_PRES_OUT_MSB_LSB_XLSB, 6)
 	if err != nil {
 		return 0, 0, err
 	}
 	up := int32(buf[0]) + int32(buf[1])<<8 + int32(buf[2])<<16
+	ut := int32(buf[3]) + int32(buf[4])<<8 + int32(buf[5])<<16
 	return ut, up, nil
 }
 
-// ReadTemperatureMult100C reads and calculates temrature in C (celsius) multiplied by 100.
-// Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP388) ReadTemperatureMult100C(i2c *i2c.I2C, accuracy AccuracyMode) (int32, error) {
-
-	ut, err := v.readUncompTemprature(i2c, accuracy)
+// compensateTemperature calculates temperature in C (celsius) multiplied by 100
+// and t_lin value, which is used for pressure compensation.
+func (v *CoeffBMP388) compensateTemperature(ut int32) (temperature int32, tLin int64, err error) {
+	err = checkRaw("temperature", ut, 24)
 	if err != nil {
-		return 0, err
-	}
-	err = v.ReadCoefficients(i2c)
-	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-
 	//  comp formula - taken from BMP3 API on github
-	partial_data1 := uint64(ut - int32(256*int32(v.Coeff.PAR_T1())))
-	partial_data2 := uint64(v.Coeff.PAR_T2()) * partial_data1
+	partial_data1 := uint64(ut - int32(256*int32(v.PAR_T1())))
+	partial_data2 := uint64(v.PAR_T2()) * partial_data1
 	partial_data3 := partial_data1 * partial_data1
-	partial_data4 := int64(partial_data3) * int64(v.Coeff.PAR_T3())
+	partial_data4 := int64(partial_data3) * int64(v.PAR_T3())
 	partial_data5 := (int64(partial_data2*262144) + partial_data4)
-	partial_data6 := partial_data5 / 4294967269
-	t := int32(partial_data6 * 25 / 16384)
+	partial_data6 := partial_data5 / 4294967296
+	t := partial_data6 * 25 / 16384
 	lg.Debugf("ut=%v", ut)
 	lg.Debugf("d1=%v ", partial_data1)
 	lg.Debugf("p_d2=%v ", partial_data2)
@@ -451,45 +572,36 @@ func (v *SensorBMP388) ReadTemperatureMult100C(i2c *i2c.I2C, accuracy AccuracyMo
 	lg.Debugf("p_d4=%v ", partial_data4)
 	lg.Debugf("p_d5=%v ", partial_data5)
 	lg.Debugf("p_d6=%v ", partial_data6)
-	return t, nil
-
-}
-
-// ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
-// Multiplication approach allow to keep result as integer number.
-func (v *SensorBMP388) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode) (uint32, error) {
-	ut, up, err := v.readUncompTempratureAndPressure(i2c, accuracy)
+	err = checkRange("temperature", float64(t)/100, minTemperatureC, maxTemperatureC)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	lg.Debugf("ut=%v, up=%v", ut, up)
+	return int32(t), partial_data6, nil
+}
 
-	err = v.ReadCoefficients(i2c)
+// compensatePressure calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Value t_lin must be taken from successful temperature compensation.
+func (v *CoeffBMP388) compensatePressure(up int32, t_lin int64) (uint32, error) {
+	err := checkRaw("pressure", up, 24)
 	if err != nil {
 		return 0, err
 	}
-
-	//  Comp temp for use in pressure comp
-	//  comp formula - taken from BMP3 API on github
-	partial_data1_t := uint64(ut - int32(256*int32(v.Coeff.PAR_T1())))
-	partial_data2_t := uint64(v.Coeff.PAR_T2()) * partial_data1_t
-	partial_data3_t := partial_data1_t * partial_data1_t
-	partial_data4_t := int64(partial_data3_t) * int64(v.Coeff.PAR_T3())
-	partial_data5_t := (int64(partial_data2_t*262144) + partial_data4_t)
-	partial_data6_t := partial_data5_t / 4294967269
-	t_lin := partial_data6_t
-	lg.Debugf("t_lin=%v", t_lin)
-	lg.Debugf("----------")
-
+	// Formulas don't guard 64-bit arithmetic against overflow,
+	// which happens with corrupted coefficients, so extra checks
+	// are made where calculations might go out of range.
+	overflow := errOverflow("pressure", minPressurePa, maxPressureBMP388Pa)
 	//  Compensate pressure - fixed point/integer arthmetic
 	//  taken form formulas written in github
 	partial_data1 := t_lin * t_lin
 	partial_data2 := partial_data1 / 64
 	partial_data3 := (partial_data2 * t_lin) / 256
-	partial_data4 := (int64(v.Coeff.PAR_P8()) * partial_data3) / 32
-	partial_data5 := (int64(v.Coeff.PAR_P7()) * partial_data1) * 16
-	partial_data6 := (int64(v.Coeff.PAR_P6()) * t_lin) * 4194304
-	offset := (int64(v.Coeff.PAR_P5()) * 140737488355328) + partial_data4 + partial_data5 + partial_data6
+	partial_data4 := (int64(v.PAR_P8()) * partial_data3) / 32
+	partial_data5 := (int64(v.PAR_P7()) * partial_data1) * 16
+	partial_data6 := (int64(v.PAR_P6()) * t_lin) * 4194304
+	offset, ok := addInt64(int64(v.PAR_P5())*140737488355328, partial_data4+partial_data5+partial_data6)
+	if !ok {
+		return 0, overflow
+	}
 	lg.Debugf("partial_data1=%v", partial_data1)
 	lg.Debugf("partial_data2=%v", partial_data2)
 	lg.Debugf("partial_data3=%v", partial_data3)
@@ -499,10 +611,10 @@ func (v *SensorBMP388) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode)
 	lg.Debugf("offset=%v", offset)
 	lg.Debugf("----------")
 
-	partial_data2 = (int64(v.Coeff.PAR_P4()) * partial_data3) / 32
-	partial_data4 = (int64(v.Coeff.PAR_P3()) * partial_data1) * 4
-	partial_data5 = (int64(v.Coeff.PAR_P2()) - 16384) * t_lin * 2097152
-	sensitivity := ((int64(v.Coeff.PAR_P1()) - 16384) * 70368744177664) + partial_data2 + partial_data4 + partial_data5
+	partial_data2 = (int64(v.PAR_P4()) * partial_data3) / 32
+	partial_data4 = (int64(v.PAR_P3()) * partial_data1) * 4
+	partial_data5 = (int64(v.PAR_P2()) - 16384) * t_lin * 2097152
+	sensitivity := ((int64(v.PAR_P1()) - 16384) * 70368744177664) + partial_data2 + partial_data4 + partial_data5
 	lg.Debugf("partial_data2=%v", partial_data2)
 	lg.Debugf("partial_data4=%v", partial_data4)
 	lg.Debugf("partial_data5=%v", partial_data5)
@@ -510,10 +622,14 @@ func (v *SensorBMP388) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode)
 	lg.Debugf("----------")
 
 	partial_data1 = (sensitivity / 16777216) * int64(up)
-	partial_data2 = int64(v.Coeff.PAR_P10()) * t_lin
-	partial_data3 = partial_data2 + (65536 * int64(v.Coeff.PAR_P9()))
+	partial_data2 = int64(v.PAR_P10()) * t_lin
+	partial_data3 = partial_data2 + (65536 * int64(v.PAR_P9()))
 	partial_data4 = (partial_data3 * int64(up)) / 8192
-	partial_data5 = (partial_data4 * int64(up)) / 512
+	partial_data5, ok = mulInt64(partial_data4, int64(up))
+	if !ok {
+		return 0, overflow
+	}
+	partial_data5 /= 512
 	partial_data6 = int64(uint64(up) * uint64(up))
 	lg.Debugf("----------")
 	lg.Debugf("partial_data1=%v", partial_data1)
@@ -523,19 +639,213 @@ func (v *SensorBMP388) ReadPressureMult10Pa(i2c *i2c.I2C, accuracy AccuracyMode)
 	lg.Debugf("partial_data5=%v", partial_data5)
 	lg.Debugf("partial_data6=%v", partial_data6)
 	lg.Debugf("----------")
-	partial_data2 = (int64(v.Coeff.PAR_P11()) * partial_data6) / 65536
+	partial_data2 = (int64(v.PAR_P11()) * partial_data6) / 65536
 	partial_data3 = (partial_data2 * int64(up)) / 128
-	partial_data4 = (offset / 4) + partial_data1 + partial_data5 + partial_data3
+	partial_data4, ok = addInt64(offset/4, partial_data1)
+	if ok {
+		partial_data4, ok = addInt64(partial_data4, partial_data5+partial_data3)
+	}
+	// Negative value or one, which overflows multiplication
+	// below, is far beyond sensor range anyway.
+	if !ok || partial_data4 < 0 || uint64(partial_data4) > math.MaxUint64/25 {
+		return 0, overflow
+	}
 	lg.Debugf("partial_data2=%v", partial_data2)
 	lg.Debugf("partial_data3=%v", partial_data3)
 	lg.Debugf("partial_data4=%v", partial_data4)
-	comp_press := uint32((uint64(partial_data4) * 25) / 1099511627776)
+	// Formula gives pressure in Pa multiplied by 100
+	comp_press := (uint64(partial_data4) * 25) / 1099511627776
+	err = checkRange("pressure", float64(comp_press)/100, minPressurePa, maxPressureBMP388Pa)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(comp_press / 10), nil
+}
 
-	return comp_press, nil
+// compensateTemperatureFloat calculates temperature in C (celsius), which
+// is t_lin value used for pressure compensation as well. Double precision
+// formulas taken from BMP3 API on github.
+func (v *CoeffBMP388) compensateTemperatureFloat(ut int32) (float64, error) {
+	err := checkRaw("temperature", ut, 24)
+	if err != nil {
+		return 0, err
+	}
+	// Coefficients quantized according to sensor specification
+	parT1 := float64(v.PAR_T1()) * math.Pow(2, 8)
+	parT2 := float64(v.PAR_T2()) / math.Pow(2, 30)
+	parT3 := float64(v.PAR_T3()) / math.Pow(2, 48)
+
+	partialData1 := float64(ut) - parT1
+	partialData2 := partialData1 * parT2
+	tLin := partialData2 + partialData1*partialData1*parT3
+	lg.Debugf("t_lin=%v", tLin)
+	err = checkRange("temperature", tLin, minTemperatureC, maxTemperatureC)
+	if err != nil {
+		return 0, err
+	}
+	return tLin, nil
+}
+
+// compensatePressureFloat calculates atmospheric pressure in Pa (Pascal).
+// Double precision formulas taken from BMP3 API on github.
+func (v *CoeffBMP388) compensatePressureFloat(up int32, tLin float64) (float64, error) {
+	err := checkRaw("pressure", up, 24)
+	if err != nil {
+		return 0, err
+	}
+	// Coefficients quantized according to sensor specification
+	parP1 := (float64(v.PAR_P1()) - math.Pow(2, 14)) / math.Pow(2, 20)
+	parP2 := (float64(v.PAR_P2()) - math.Pow(2, 14)) / math.Pow(2, 29)
+	parP3 := float64(v.PAR_P3()) / math.Pow(2, 32)
+	parP4 := float64(v.PAR_P4()) / math.Pow(2, 37)
+	parP5 := float64(v.PAR_P5()) * math.Pow(2, 3)
+	parP6 := float64(v.PAR_P6()) / math.Pow(2, 6)
+	parP7 := float64(v.PAR_P7()) / math.Pow(2, 8)
+	parP8 := float64(v.PAR_P8()) / math.Pow(2, 15)
+	parP9 := float64(v.PAR_P9()) / math.Pow(2, 48)
+	parP10 := float64(v.PAR_P10()) / math.Pow(2, 48)
+	parP11 := float64(v.PAR_P11()) / math.Pow(2, 65)
+
+	partialOut1 := parP5 + parP6*tLin + parP7*tLin*tLin + parP8*tLin*tLin*tLin
+	partialOut2 := float64(up) * (parP1 + parP2*tLin + parP3*tLin*tLin + parP4*tLin*tLin*tLin)
+	upf := float64(up)
+	partialData4 := upf*upf*(parP9+parP10*tLin) + upf*upf*upf*parP11
+	p := partialOut1 + partialOut2 + partialData4
+	err = checkRange("pressure", p, minPressurePa, maxPressureBMP388Pa)
+	if err != nil {
+		return 0, err
+	}
+	return p, nil
+}
+
+// CompensateBMP388 calculates temperature and atmospheric pressure
+// from uncompensated ADC values and calibration coefficients. Function
+// doesn't access sensor, so it can be used to post-process recorded raw data.
+// Raw values, which don't fit ADC resolution, or give results outside
+// of sensor operating range, are reported as ErrOutOfRange.
+func CompensateBMP388(coeff *CoeffBMP388, rawT, rawP int32) (*Measurement, error) {
+	return compensateBMP388(coeff, rawT, rawP, true, COMPENSATION_INTEGER)
+}
+
+// CompensateBMP388Float is CompensateBMP388, which use double
+// precision formulas, so values are returned in full resolution.
+func CompensateBMP388Float(coeff *CoeffBMP388, rawT, rawP int32) (*Measurement, error) {
+	return compensateBMP388(coeff, rawT, rawP, true, COMPENSATION_FLOAT64)
+}
+
+// compensateBMP388 calculates temperature, and pressure if
+// it's measured, with formulas selected by compensation mode.
+func compensateBMP388(coeff *CoeffBMP388, rawT, rawP int32, pressure bool,
+	mode CompensationMode) (*Measurement, error) {
+	if coeff == nil {
+		return nil, ErrNoCalibration
+	}
+	m := &Measurement{}
+	if mode == COMPENSATION_FLOAT64 {
+		tLin, err := coeff.compensateTemperatureFloat(rawT)
+		if err != nil {
+			return nil, err
+		}
+		m.Temperature = tLin
+		if pressure {
+			m.Pressure, err = coeff.compensatePressureFloat(rawP, tLin)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	t, tLin, err := coeff.compensateTemperature(rawT)
+	if err != nil {
+		return nil, err
+	}
+	m.Temperature = float64(t) / 100
+	if pressure {
+		p, err := coeff.compensatePressure(rawP, tLin)
+		if err != nil {
+			return nil, err
+		}
+		m.Pressure = float64(p) / 10
+	}
+	return m, nil
+}
+
+// ReadTemperatureMult100C reads and calculates temrature in C (celsius) multiplied by 100.
+// Multiplication approach allow to keep result as integer number.
+func (v *SensorBMP388) ReadTemperatureMult100C(ctx context.Context, bus Bus, accuracy AccuracyMode) (int32, error) {
+	ut, err := v.readUncompTemprature(ctx, bus, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	t, _, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
+	}
+	return t, nil
+}
+
+// ReadPressureMult10Pa reads and calculates atmospheric pressure in Pa (Pascal) multiplied by 10.
+// Multiplication approach allow to keep result as integer number.
+func (v *SensorBMP388) ReadPressureMult10Pa(ctx context.Context, bus Bus, accuracy AccuracyMode) (uint32, error) {
+	if v.config != nil && v.config.Pressure == OVERSAMPLING_SKIPPED {
+		return 0, errSkipped("pressure")
+	}
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
+	if err != nil {
+		return 0, err
+	}
+	lg.Debugf("ut=%v, up=%v", ut, up)
+
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return 0, err
+	}
+	_, tLin, err := v.Coeff.compensateTemperature(ut)
+	if err != nil {
+		return 0, err
+	}
+	lg.Debugf("t_lin=%v", tLin)
+	return v.Coeff.compensatePressure(up, tLin)
 }
 
 // ReadHumidityMultQ2210 does nothing. Humidity function is not applicable for BMP388.
-func (v *SensorBMP388) ReadHumidityMultQ2210(i2c *i2c.I2C, accuracy AccuracyMode) (bool, uint32, error) {
+func (v *SensorBMP388) ReadHumidityMultQ2210(ctx context.Context, bus Bus, accuracy AccuracyMode) (bool, uint32, error) {
 	// Not supported
 	return false, 0, nil
 }
+
+// ReadAll reads temperature and atmospheric pressure
+// obtained from single conversion.
+func (v *SensorBMP388) ReadAll(ctx context.Context, bus Bus, accuracy AccuracyMode) (*Measurement, error) {
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("ut=%v, up=%v", ut, up)
+
+	err = v.loadCoefficients(bus)
+	if err != nil {
+		return nil, err
+	}
+	pressure := v.measured.Pressure != OVERSAMPLING_SKIPPED
+	return compensateBMP388(v.Coeff, ut, up, pressure, v.compensation)
+}
+
+// ReadRaw reads uncompensated temperature and atmospheric
+// pressure obtained from single conversion.
+func (v *SensorBMP388) ReadRaw(ctx context.Context, bus Bus, accuracy AccuracyMode) (*RawMeasurement, error) {
+	ut, up, err := v.readUncompTempratureAndPressure(ctx, bus, accuracy)
+	if err != nil {
+		return nil, err
+	}
+	m := &RawMeasurement{
+		Temperature: ut,
+		Pressure:    up,
+		Config:      v.measured,
+	}
+	return m, nil
+}
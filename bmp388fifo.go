@@ -0,0 +1,427 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"context"
+	"fmt"
+)
+
+// BMP388 FIFO registers and values
+const (
+	BMP388_FIFO_LENGTH_0 = 0x12
+	BMP388_FIFO_LENGTH_1 = 0x13
+	BMP388_FIFO_DATA     = 0x14
+	BMP388_FIFO_WTM_0    = 0x15
+	BMP388_FIFO_WTM_1    = 0x16
+	BMP388_FIFO_CONFIG_1 = 0x17
+	BMP388_FIFO_CONFIG_2 = 0x18
+
+	// FIFO_CONFIG_1 flags
+	BMP388_FIFO_MODE         = 0x01
+	BMP388_FIFO_STOP_ON_FULL = 0x02
+	BMP388_FIFO_TIME_EN      = 0x04
+	BMP388_FIFO_PRESS_EN     = 0x08
+	BMP388_FIFO_TEMP_EN      = 0x10
+
+	// FIFO_CONFIG_2 data_select: filtered data
+	BMP388_FIFO_DATA_FILTERED = 0x08
+
+	// Command of CMD register to clear FIFO
+	BMP388_CMD_FIFO_FLUSH = 0xB0
+
+	// FIFO capacity in bytes
+	BMP388_FIFO_SIZE = 512
+
+	// Frame headers
+	BMP388_FIFO_TEMP_PRESS_FRAME = 0x94
+	BMP388_FIFO_TEMP_FRAME       = 0x90
+	BMP388_FIFO_PRESS_FRAME      = 0x84
+	BMP388_FIFO_TIME_FRAME       = 0xA0
+	BMP388_FIFO_EMPTY_FRAME      = 0x80
+	BMP388_FIFO_CONFIG_CHANGE    = 0x48
+	BMP388_FIFO_CONFIG_ERROR     = 0x44
+)
+
+// FIFOConfigBMP388 keeps BMP388 FIFO settings. FIFO is filled
+// in normal mode only, with rate of conversions (see SetNormalMode)
+// reduced by subsampling.
+type FIFOConfigBMP388 struct {
+	// Store pressure in FIFO. Pressure frames without temperature
+	// can't be compensated by ReadFIFO, so keep temperature enabled,
+	// or decode raw content with ParseFIFOBMP388.
+	Pressure bool
+	// Store temperature in FIFO.
+	Temperature bool
+	// Append sensor time frame, once FIFO is drained.
+	SensorTime bool
+	// Stop writing, when FIFO is full, otherwise oldest frames are dropped.
+	StopOnFull bool
+	// Store each 2^Subsampling conversion only (0..7).
+	Subsampling byte
+	// Store IIR filtered data instead of unfiltered.
+	Filtered bool
+	// FIFO fill level in bytes, which triggers watermark interrupt (0..511).
+	Watermark uint16
+}
+
+// FIFOBMP388 keeps data drained from BMP388 FIFO.
+type FIFOBMP388 struct {
+	// Compensated measurements in order of conversions. Pressure is
+	// zero, when it's not stored. Pressure only frames are compensated
+	// with temperature of latest frame, which keeps it.
+	Measurements []Measurement
+	// Sensor time of latest frame in ticks of 39.0625 us,
+	// if SensorTimeValid is true.
+	SensorTime      uint32
+	SensorTimeValid bool
+	// Amount of config change frames, which mark FIFO settings changes.
+	ConfigChanges int
+	// Amount of config error frames, which mark rejected settings.
+	ConfigErrors int
+	// Amount of sensor frames, which failed to be compensated.
+	Skipped int
+	// Raw FIFO content, which data is decoded from.
+	Raw []byte
+}
+
+// FIFOFrameBMP388 is a single frame decoded from BMP388 FIFO.
+type FIFOFrameBMP388 struct {
+	// Frame header, one of BMP388_FIFO_..._FRAME and
+	// BMP388_FIFO_CONFIG_... constants.
+	Header byte
+	// Uncompensated values of sensor frames.
+	RawTemperature int32
+	RawPressure    int32
+	// Sensor time of sensor time frame.
+	SensorTime uint32
+}
+
+// HasTemperature verify that frame keeps temperature.
+func (v *FIFOFrameBMP388) HasTemperature() bool {
+	return v.Header == BMP388_FIFO_TEMP_PRESS_FRAME || v.Header == BMP388_FIFO_TEMP_FRAME
+}
+
+// HasPressure verify that frame keeps pressure.
+func (v *FIFOFrameBMP388) HasPressure() bool {
+	return v.Header == BMP388_FIFO_TEMP_PRESS_FRAME || v.Header == BMP388_FIFO_PRESS_FRAME
+}
+
+// getFIFOFrameSize returns amount of data bytes following
+// frame header, or -1 for unknown header.
+func getFIFOFrameSize(header byte) int {
+	switch header {
+	case BMP388_FIFO_TEMP_PRESS_FRAME:
+		return 6
+	case BMP388_FIFO_TEMP_FRAME, BMP388_FIFO_PRESS_FRAME, BMP388_FIFO_TIME_FRAME:
+		return 3
+	case BMP388_FIFO_CONFIG_CHANGE, BMP388_FIFO_CONFIG_ERROR, BMP388_FIFO_EMPTY_FRAME:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// ParseFIFOBMP388 decodes raw BMP388 FIFO content, read from
+// FIFO_DATA register, up to empty frame or end of data.
+// Function doesn't access sensor, so it can be used
+// to decode FIFO dumps saved elsewhere. On error frames
+// decoded before corrupted one are returned as well.
+func ParseFIFOBMP388(data []byte) ([]FIFOFrameBMP388, error) {
+	var frames []FIFOFrameBMP388
+	for i := 0; i < len(data); {
+		header := data[i]
+		if header == BMP388_FIFO_EMPTY_FRAME {
+			break
+		}
+		size := getFIFOFrameSize(header)
+		if size < 0 {
+			return frames, fmt.Errorf("unknown FIFO frame header 0x%02X at offset %d", header, i)
+		}
+		if i+1+size > len(data) {
+			return frames, fmt.Errorf("FIFO frame 0x%02X at offset %d is truncated", header, i)
+		}
+		b := data[i+1 : i+1+size]
+		frame := FIFOFrameBMP388{Header: header}
+		switch header {
+		case BMP388_FIFO_TEMP_PRESS_FRAME:
+			frame.RawTemperature = int32(getU24LE(b[0:3]))
+			frame.RawPressure = int32(getU24LE(b[3:6]))
+		case BMP388_FIFO_TEMP_FRAME:
+			frame.RawTemperature = int32(getU24LE(b))
+		case BMP388_FIFO_PRESS_FRAME:
+			frame.RawPressure = int32(getU24LE(b))
+		case BMP388_FIFO_TIME_FRAME:
+			frame.SensorTime = getU24LE(b)
+		}
+		frames = append(frames, frame)
+		i += 1 + size
+	}
+	return frames, nil
+}
+
+// getU24LE extract 3-byte unsigned little-endian integer.
+func getU24LE(buf []byte) uint32 {
+	return uint32(buf[2])<<16 | uint32(buf[1])<<8 | uint32(buf[0])
+}
+
+// CompensateFIFOBMP388 decodes raw BMP388 FIFO content and
+// compensates measurements with integer formulas from datasheet,
+// using calibration coefficients, stored with sensor data.
+// Frames, which can't be decoded or compensated, are skipped:
+// first error is returned together with the rest of data.
+func CompensateFIFOBMP388(coeff *CoeffBMP388, data []byte) (*FIFOBMP388, error) {
+	return compensateFIFOBMP388(coeff, data, COMPENSATION_INTEGER)
+}
+
+// CompensateFIFOBMP388Float is CompensateFIFOBMP388,
+// which use double precision formulas.
+func CompensateFIFOBMP388Float(coeff *CoeffBMP388, data []byte) (*FIFOBMP388, error) {
+	return compensateFIFOBMP388(coeff, data, COMPENSATION_FLOAT64)
+}
+
+// compensateFIFOBMP388 decodes FIFO content and converts
+// frames to measurements with formulas selected by mode.
+func compensateFIFOBMP388(coeff *CoeffBMP388, data []byte,
+	mode CompensationMode) (*FIFOBMP388, error) {
+	if coeff == nil {
+		return nil, ErrNoCalibration
+	}
+	fifo := &FIFOBMP388{Raw: data}
+	// Frames decoded before corrupted one are kept
+	frames, parseErr := ParseFIFOBMP388(data)
+	var firstErr error
+	var rawT int32
+	var temperature bool
+	for i, frame := range frames {
+		switch frame.Header {
+		case BMP388_FIFO_TEMP_PRESS_FRAME, BMP388_FIFO_TEMP_FRAME, BMP388_FIFO_PRESS_FRAME:
+			var m *Measurement
+			var err error
+			if frame.HasTemperature() {
+				rawT, temperature = frame.RawTemperature, true
+			}
+			if temperature {
+				m, err = compensateBMP388(coeff, rawT, frame.RawPressure, frame.HasPressure(), mode)
+			} else {
+				err = fmt.Errorf("pressure frame precedes any temperature one")
+			}
+			if err != nil {
+				fifo.Skipped++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("FIFO frame %d: %w", i, err)
+				}
+				continue
+			}
+			fifo.Measurements = append(fifo.Measurements, *m)
+		case BMP388_FIFO_TIME_FRAME:
+			fifo.SensorTime = frame.SensorTime
+			fifo.SensorTimeValid = true
+		case BMP388_FIFO_CONFIG_CHANGE:
+			fifo.ConfigChanges++
+		case BMP388_FIFO_CONFIG_ERROR:
+			fifo.ConfigErrors++
+		}
+	}
+	if firstErr == nil {
+		firstErr = parseErr
+	}
+	return fifo, firstErr
+}
+
+// SetFIFOConfig writes FIFO settings to sensor. Pass nil to disable FIFO.
+func (v *SensorBMP388) SetFIFOConfig(bus Bus, config *FIFOConfigBMP388) error {
+	var cfg1, cfg2 byte
+	var wtm uint16
+	if config != nil {
+		if config.Subsampling > 7 {
+			return fmt.Errorf("FIFO subsampling 2^%d is %w by BMP388",
+				config.Subsampling, ErrNotSupported)
+		}
+		if config.Watermark >= BMP388_FIFO_SIZE {
+			return fmt.Errorf("FIFO watermark %d is %w by BMP388",
+				config.Watermark, ErrNotSupported)
+		}
+		cfg1 = BMP388_FIFO_MODE
+		if config.StopOnFull {
+			cfg1 |= BMP388_FIFO_STOP_ON_FULL
+		}
+		if config.SensorTime {
+			cfg1 |= BMP388_FIFO_TIME_EN
+		}
+		if config.Pressure {
+			cfg1 |= BMP388_FIFO_PRESS_EN
+		}
+		if config.Temperature {
+			cfg1 |= BMP388_FIFO_TEMP_EN
+		}
+		cfg2 = config.Subsampling
+		if config.Filtered {
+			cfg2 |= BMP388_FIFO_DATA_FILTERED
+		}
+		wtm = config.Watermark
+		c := *config
+		config = &c
+	}
+	regs := []struct {
+		reg   byte
+		value byte
+	}{
+		{BMP388_FIFO_WTM_0, byte(wtm)},
+		{BMP388_FIFO_WTM_1, byte(wtm >> 8)},
+		{BMP388_FIFO_CONFIG_2, cfg2},
+		{BMP388_FIFO_CONFIG_1, cfg1},
+	}
+	for _, r := range regs {
+		err := bus.WriteRegU8(r.reg, r.value)
+		if err != nil {
+			return err
+		}
+	}
+	v.fifo = config
+	return nil
+}
+
+// FlushFIFO clears all data stored in FIFO.
+func (v *SensorBMP388) FlushFIFO(bus Bus) error {
+	return bus.WriteRegU8(BMP388_CMD_REG, BMP388_CMD_FIFO_FLUSH)
+}
+
+// ReadFIFOLength reads FIFO fill level in bytes. Byte counter is
+// 9 bits wide, so it can't report completely full FIFO of 512 bytes,
+// which might be reached with 4-byte frames only.
+func (v *SensorBMP388) ReadFIFOLength(bus Bus) (int, error) {
+	buf, err := bus.ReadRegBytes(BMP388_FIFO_LENGTH_0, 2)
+	if err != nil {
+		return 0, err
+	}
+	return int(buf[1]&0x01)<<8 | int(buf[0]), nil
+}
+
+// ReadFIFOBytes drains FIFO with single burst read and returns
+// raw content, which might be decoded with ParseFIFOBMP388.
+func (v *SensorBMP388) ReadFIFOBytes(ctx context.Context, bus Bus) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	n, err := v.ReadFIFOLength(bus)
+	if err != nil {
+		return nil, err
+	}
+	lg.Debugf("FIFO length=%v", n)
+	if v.fifo != nil && v.fifo.SensorTime {
+		// Sensor time frame is appended after the last one
+		n += 4
+	}
+	if n == 0 {
+		return []byte{}, nil
+	}
+	return bus.ReadRegBytes(BMP388_FIFO_DATA, n)
+}
+
+// ReadFIFO drains FIFO with single burst read, then decodes and
+// compensates frames, using formulas selected by SetCompensationMode.
+// Since FIFO is drained, measurements are returned even with error,
+// if only some frames fail, while raw content is kept in Raw field.
+func (v *SensorBMP388) ReadFIFO(ctx context.Context, bus Bus) (*FIFOBMP388, error) {
+	err := v.loadCoefficients(bus)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := v.ReadFIFOBytes(ctx, bus)
+	if err != nil {
+		return nil, err
+	}
+	return compensateFIFOBMP388(v.Coeff, buf, v.compensation)
+}
+
+// bmp388 returns BMP388 specific sensor object, or
+// ErrNotSupported, if another sensor is connected.
+func (v *BMP) bmp388() (*SensorBMP388, error) {
+	sensor, ok := v.bmp.(*SensorBMP388)
+	if !ok {
+		return nil, fmt.Errorf("feature is %w by %v", ErrNotSupported, v.sensorType)
+	}
+	return sensor, nil
+}
+
+// SetFIFOConfig writes BMP388 FIFO settings. Pass nil to disable FIFO.
+// FIFO is filled in normal mode only (see SetNormalMode).
+func (v *BMP) SetFIFOConfig(config *FIFOConfigBMP388) error {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return err
+	}
+	return sensor.SetFIFOConfig(v.bus, config)
+}
+
+// FlushFIFO clears all data stored in BMP388 FIFO.
+func (v *BMP) FlushFIFO() error {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return err
+	}
+	return sensor.FlushFIFO(v.bus)
+}
+
+// ReadFIFOLength reads BMP388 FIFO fill level in bytes.
+func (v *BMP) ReadFIFOLength() (int, error) {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return 0, err
+	}
+	return sensor.ReadFIFOLength(v.bus)
+}
+
+// ReadFIFO drains BMP388 FIFO and returns compensated measurements.
+// Frames, which fail to be compensated, are skipped: error is returned
+// together with the rest of measurements and raw FIFO content.
+func (v *BMP) ReadFIFO() (*FIFOBMP388, error) {
+	return v.ReadFIFOContext(context.Background())
+}
+
+// ReadFIFOContext is ReadFIFO, which returns
+// immediately, if context is cancelled or expired.
+func (v *BMP) ReadFIFOContext(ctx context.Context) (*FIFOBMP388, error) {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return nil, err
+	}
+	return sensor.ReadFIFO(ctx, v.bus)
+}
+
+// ReadFIFOBytes drains BMP388 FIFO and returns raw content, which
+// might be saved and decoded later with CompensateFIFOBMP388.
+func (v *BMP) ReadFIFOBytes() ([]byte, error) {
+	return v.ReadFIFOBytesContext(context.Background())
+}
+
+// ReadFIFOBytesContext is ReadFIFOBytes, which returns
+// immediately, if context is cancelled or expired.
+func (v *BMP) ReadFIFOBytesContext(ctx context.Context) ([]byte, error) {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return nil, err
+	}
+	return sensor.ReadFIFOBytes(ctx, v.bus)
+}
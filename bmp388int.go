@@ -0,0 +1,137 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import "fmt"
+
+// BMP388 interrupt registers and bits
+const (
+	BMP388_INT_STATUS = 0x11
+	BMP388_INT_CTRL   = 0x19
+
+	// INT_STATUS flags, cleared on read
+	BMP388_INT_STATUS_FWM   = 0x01
+	BMP388_INT_STATUS_FFULL = 0x02
+	BMP388_INT_STATUS_DRDY  = 0x08
+
+	// INT_CTRL flags
+	BMP388_INT_OD       = 0x01
+	BMP388_INT_LEVEL    = 0x02
+	BMP388_INT_LATCH    = 0x04
+	BMP388_INT_FWTM_EN  = 0x08
+	BMP388_INT_FFULL_EN = 0x10
+	BMP388_INT_DRDY_EN  = 0x40
+)
+
+// InterruptConfigBMP388 keeps BMP388 INT pin settings and
+// interrupt sources. Sources are combined by OR.
+type InterruptConfigBMP388 struct {
+	// Open-drain output instead of push-pull.
+	OpenDrain bool
+	// INT pin is active high instead of active low.
+	ActiveHigh bool
+	// Keep INT pin and status asserted, until INT_STATUS is read.
+	Latch bool
+	// Trigger interrupt, when conversion is completed.
+	DataReady bool
+	// Trigger interrupt, when FIFO fill level reach watermark
+	// (see FIFOConfigBMP388).
+	FIFOWatermark bool
+	// Trigger interrupt, when FIFO is full.
+	FIFOFull bool
+}
+
+// InterruptStatusBMP388 keeps BMP388 interrupt flags.
+type InterruptStatusBMP388 struct {
+	FIFOWatermark bool
+	FIFOFull      bool
+	DataReady     bool
+}
+
+// String implement Stringer interface.
+func (v InterruptStatusBMP388) String() string {
+	return fmt.Sprintf("data ready=%v, FIFO watermark=%v, FIFO full=%v",
+		v.DataReady, v.FIFOWatermark, v.FIFOFull)
+}
+
+// SetInterruptConfig writes INT pin settings and interrupt sources
+// to sensor. Pass nil to disable interrupts and restore default
+// pin settings (push-pull, active high).
+func (v *SensorBMP388) SetInterruptConfig(bus Bus, config *InterruptConfigBMP388) error {
+	var ctrl byte = BMP388_INT_LEVEL
+	if config != nil {
+		ctrl = 0
+		if config.OpenDrain {
+			ctrl |= BMP388_INT_OD
+		}
+		if config.ActiveHigh {
+			ctrl |= BMP388_INT_LEVEL
+		}
+		if config.Latch {
+			ctrl |= BMP388_INT_LATCH
+		}
+		if config.FIFOWatermark {
+			ctrl |= BMP388_INT_FWTM_EN
+		}
+		if config.FIFOFull {
+			ctrl |= BMP388_INT_FFULL_EN
+		}
+		if config.DataReady {
+			ctrl |= BMP388_INT_DRDY_EN
+		}
+	}
+	lg.Debugf("int_ctrl=0x%X", ctrl)
+	return bus.WriteRegU8(BMP388_INT_CTRL, ctrl)
+}
+
+// ReadInterruptStatus reads interrupt flags. Sensor clears flags
+// on read, as well as INT pin in latched mode.
+func (v *SensorBMP388) ReadInterruptStatus(bus Bus) (InterruptStatusBMP388, error) {
+	b, err := bus.ReadRegU8(BMP388_INT_STATUS)
+	if err != nil {
+		return InterruptStatusBMP388{}, err
+	}
+	return InterruptStatusBMP388{
+		FIFOWatermark: b&BMP388_INT_STATUS_FWM != 0,
+		FIFOFull:      b&BMP388_INT_STATUS_FFULL != 0,
+		DataReady:     b&BMP388_INT_STATUS_DRDY != 0,
+	}, nil
+}
+
+// SetInterruptConfig writes BMP388 INT pin settings and interrupt
+// sources. Pass nil to disable interrupts.
+func (v *BMP) SetInterruptConfig(config *InterruptConfigBMP388) error {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return err
+	}
+	return sensor.SetInterruptConfig(v.bus, config)
+}
+
+// ReadInterruptStatus reads and clears BMP388 interrupt flags.
+func (v *BMP) ReadInterruptStatus() (InterruptStatusBMP388, error) {
+	sensor, err := v.bmp388()
+	if err != nil {
+		return InterruptStatusBMP388{}, err
+	}
+	return sensor.ReadInterruptStatus(v.bus)
+}
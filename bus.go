@@ -0,0 +1,118 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	i2c "github.com/d2r2/go-i2c"
+)
+
+// Bus abstract register-level transport used to communicate
+// with sensor. Implement this interface to attach sensor via
+// other bus libraries, USB bridges or emulated devices.
+type Bus interface {
+	// ReadRegU8 reads single byte from register.
+	ReadRegU8(reg byte) (byte, error)
+	// ReadRegBytes reads block of n bytes starting from register.
+	ReadRegBytes(reg byte, n int) ([]byte, error)
+	// WriteRegU8 writes single byte to register.
+	WriteRegU8(reg byte, value byte) error
+}
+
+// I2CBus adapts i2c connection from github.com/d2r2/go-i2c
+// to the Bus interface.
+type I2CBus struct {
+	i2c *i2c.I2C
+}
+
+// Static cast to verify at compile time
+// that type implement interface.
+var _ Bus = &I2CBus{}
+
+// NewI2CBus creates Bus on top of opened i2c connection.
+func NewI2CBus(i2c *i2c.I2C) *I2CBus {
+	v := &I2CBus{i2c: i2c}
+	return v
+}
+
+// ReadRegU8 reads single byte from register.
+func (v *I2CBus) ReadRegU8(reg byte) (byte, error) {
+	return v.i2c.ReadRegU8(reg)
+}
+
+// ReadRegBytes reads block of n bytes starting from register.
+func (v *I2CBus) ReadRegBytes(reg byte, n int) ([]byte, error) {
+	buf, _, err := v.i2c.ReadRegBytes(reg, n)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// WriteRegU8 writes single byte to register.
+func (v *I2CBus) WriteRegU8(reg byte, value byte) error {
+	return v.i2c.WriteRegU8(reg, value)
+}
+
+// checkedBus decorates Bus to report any transport
+// failure as ErrBusIO, keeping original error inside.
+type checkedBus struct {
+	bus Bus
+}
+
+// Static cast to verify at compile time
+// that type implement interface.
+var _ Bus = &checkedBus{}
+
+// newCheckedBus wraps bus, unless it's wrapped already.
+func newCheckedBus(bus Bus) Bus {
+	if _, ok := bus.(*checkedBus); ok {
+		return bus
+	}
+	return &checkedBus{bus: bus}
+}
+
+// ReadRegU8 reads single byte from register.
+func (v *checkedBus) ReadRegU8(reg byte) (byte, error) {
+	b, err := v.bus.ReadRegU8(reg)
+	if err != nil {
+		return 0, &ErrBusIO{Op: "read", Reg: reg, Err: err}
+	}
+	return b, nil
+}
+
+// ReadRegBytes reads block of n bytes starting from register.
+func (v *checkedBus) ReadRegBytes(reg byte, n int) ([]byte, error) {
+	buf, err := v.bus.ReadRegBytes(reg, n)
+	if err != nil {
+		return nil, &ErrBusIO{Op: "read", Reg: reg, Err: err}
+	}
+	return buf, nil
+}
+
+// WriteRegU8 writes single byte to register.
+func (v *checkedBus) WriteRegU8(reg byte, value byte) error {
+	err := v.bus.WriteRegU8(reg, value)
+	if err != nil {
+		return &ErrBusIO{Op: "write", Reg: reg, Err: err}
+	}
+	return nil
+}
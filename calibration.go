@@ -0,0 +1,209 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Calibration keeps calibration coefficients of specific sensor in
+// serializable form, which allows to archive them and compensate
+// raw ADC values later without access to sensor. Raw field is an
+// authoritative source: it keeps NVM bytes in register order (BME280
+// blocks 0x88..0x9F, 0xA1 and 0xE1..0xE7 are concatenated), while
+// Params are decoded for human reading (dig_T1, PAR_P5 and so on).
+type Calibration struct {
+	SensorType SensorType       `json:"sensor"`
+	ChipID     uint8            `json:"chip_id"`
+	Params     map[string]int64 `json:"params"`
+	Raw        []byte           `json:"raw"`
+}
+
+// coefficients is implemented by each of CoeffBMPxxx structs.
+type coefficients interface {
+	// params returns decoded calibration coefficients by name.
+	params() map[string]int64
+}
+
+// newCoefficients creates empty coefficient's struct for sensor type.
+func newCoefficients(sensorType SensorType) (coefficients, error) {
+	switch sensorType {
+	case BMP180:
+		return &CoeffBMP180{}, nil
+	case BMP280:
+		return &CoeffBMP280{}, nil
+	case BME280:
+		return &CoeffBME280{}, nil
+	case BMP388:
+		return &CoeffBMP388{}, nil
+	default:
+		return nil, fmt.Errorf("sensor type %v is %w", sensorType, ErrNotSupported)
+	}
+}
+
+// NewCalibration creates calibration record from raw
+// NVM bytes, as they are stored in sensor registers.
+func NewCalibration(sensorType SensorType, chipID uint8, raw []byte) (*Calibration, error) {
+	coeff, err := newCoefficients(sensorType)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != binary.Size(coeff) {
+		return nil, fmt.Errorf("%v calibration takes %d bytes, but %d given",
+			sensorType, binary.Size(coeff), len(raw))
+	}
+	err = binary.Read(bytes.NewReader(raw), binary.LittleEndian, coeff)
+	if err != nil {
+		return nil, err
+	}
+	v := &Calibration{
+		SensorType: sensorType,
+		ChipID:     chipID,
+		Params:     coeff.params(),
+		Raw:        append([]byte(nil), raw...),
+	}
+	return v, nil
+}
+
+// newCalibrationFromCoeff creates calibration record from coefficients.
+func newCalibrationFromCoeff(sensorType SensorType, chipID uint8,
+	coeff coefficients) (*Calibration, error) {
+	buf := &bytes.Buffer{}
+	err := binary.Write(buf, binary.LittleEndian, coeff)
+	if err != nil {
+		return nil, err
+	}
+	return NewCalibration(sensorType, chipID, buf.Bytes())
+}
+
+// UnmarshalJSON implement json.Unmarshaler interface. Raw bytes
+// are decoded once again, so record is rejected, if named
+// parameters don't match raw data (e.g. edited by hand),
+// with ErrCalibrationMismatch.
+func (v *Calibration) UnmarshalJSON(data []byte) error {
+	// Type alias prevents recursive call of UnmarshalJSON
+	type calibration Calibration
+	var c calibration
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return err
+	}
+	decoded, err := NewCalibration(c.SensorType, c.ChipID, c.Raw)
+	if err != nil {
+		return err
+	}
+	for name, value := range c.Params {
+		expected, ok := decoded.Params[name]
+		if !ok {
+			return fmt.Errorf("unknown %v calibration parameter %s", c.SensorType, name)
+		}
+		if expected != value {
+			return &ErrCalibrationMismatch{Field: name, Param: value, Raw: expected}
+		}
+	}
+	*v = *decoded
+	return nil
+}
+
+// decode restores coefficients from raw bytes,
+// verifying that record belongs to sensor type.
+func (v *Calibration) decode(sensorType SensorType, coeff coefficients) error {
+	if v.SensorType != sensorType {
+		return fmt.Errorf("calibration of %v can't be used for %v", v.SensorType, sensorType)
+	}
+	if len(v.Raw) != binary.Size(coeff) {
+		return fmt.Errorf("%v calibration takes %d bytes, but %d given",
+			sensorType, binary.Size(coeff), len(v.Raw))
+	}
+	return binary.Read(bytes.NewReader(v.Raw), binary.LittleEndian, coeff)
+}
+
+// CoeffBMP180 restores BMP180 coefficients from calibration record.
+func (v *Calibration) CoeffBMP180() (*CoeffBMP180, error) {
+	coeff := &CoeffBMP180{}
+	err := v.decode(BMP180, coeff)
+	if err != nil {
+		return nil, err
+	}
+	return coeff, nil
+}
+
+// CoeffBMP280 restores BMP280 coefficients from calibration record.
+func (v *Calibration) CoeffBMP280() (*CoeffBMP280, error) {
+	coeff := &CoeffBMP280{}
+	err := v.decode(BMP280, coeff)
+	if err != nil {
+		return nil, err
+	}
+	return coeff, nil
+}
+
+// CoeffBME280 restores BME280 coefficients from calibration record.
+func (v *Calibration) CoeffBME280() (*CoeffBME280, error) {
+	coeff := &CoeffBME280{}
+	err := v.decode(BME280, coeff)
+	if err != nil {
+		return nil, err
+	}
+	return coeff, nil
+}
+
+// CoeffBMP388 restores BMP388 coefficients from calibration record.
+func (v *Calibration) CoeffBMP388() (*CoeffBMP388, error) {
+	coeff := &CoeffBMP388{}
+	err := v.decode(BMP388, coeff)
+	if err != nil {
+		return nil, err
+	}
+	return coeff, nil
+}
+
+// Calibration returns calibration coefficients of sensor
+// together with sensor identifier, ready to be stored as JSON.
+func (v *BMP) Calibration() (*Calibration, error) {
+	id, err := v.ReadSensorID()
+	if err != nil {
+		return nil, err
+	}
+	var coeff coefficients
+	switch sensor := v.bmp.(type) {
+	case *SensorBMP180:
+		err = sensor.loadCoefficients(v.bus)
+		coeff = sensor.Coeff
+	case *SensorBMP280:
+		err = sensor.loadCoefficients(v.bus)
+		coeff = sensor.Coeff
+	case *SensorBME280:
+		err = sensor.loadCoefficients(v.bus)
+		coeff = sensor.Coeff
+	case *SensorBMP388:
+		err = sensor.loadCoefficients(v.bus)
+		coeff = sensor.Coeff
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newCalibrationFromCoeff(v.sensorType, id, coeff)
+}
@@ -0,0 +1,105 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"fmt"
+
+	i2c "github.com/d2r2/go-i2c"
+)
+
+// Standard i2c addresses of Bosch Sensortec sensors.
+// BMP180 always use 0x77, the rest select address with SDO pin.
+const (
+	I2C_ADDR_SDO_LOW  = 0x76
+	I2C_ADDR_SDO_HIGH = 0x77
+)
+
+// Order in which sensor types are probed, grouped by identifier
+// register, so that each register is read once. Sensors sharing
+// ID register 0xD0 go first, since BMP388 keeps identifier
+// in register 0x00.
+var detectOrder = []struct {
+	reg         byte
+	sensorTypes []SensorType
+}{
+	{BMP280_ID_REG, []SensorType{BMP180, BMP280, BME280}},
+	{BMP388_ID_REG, []SensorType{BMP388}},
+}
+
+// Probe reads sensor identifier registers via bus and returns
+// sensor type recognized together with its signature.
+func Probe(bus Bus) (SensorType, uint8, error) {
+	bus = newCheckedBus(bus)
+	var ids []uint8
+	for _, group := range detectOrder {
+		id, err := bus.ReadRegU8(group.reg)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, sensorType := range group.sensorTypes {
+			sensor, err := newSensor(sensorType)
+			if err != nil {
+				return 0, 0, err
+			}
+			_, err = sensor.RecognizeSignature(id)
+			if err == nil {
+				lg.Debugf("Sensor %v with signature 0x%X recognized", sensorType, id)
+				return sensorType, id, nil
+			}
+		}
+		ids = append(ids, id)
+	}
+	return 0, 0, fmt.Errorf("%w: signatures %v don't belong to any supported sensor",
+		ErrNoSensor, ids)
+}
+
+// DetectBus recognizes sensor attached to bus and
+// creates sensor object of corresponding type.
+func DetectBus(bus Bus) (*BMP, error) {
+	sensorType, _, err := Probe(bus)
+	if err != nil {
+		return nil, err
+	}
+	return NewBMPBus(sensorType, bus)
+}
+
+// Detect scans standard addresses 0x76 and 0x77 on i2c-bus line
+// and creates sensor object for first sensor recognized.
+// Returned i2c connection should be closed by caller.
+func Detect(line int) (*BMP, *i2c.I2C, error) {
+	for _, addr := range []uint8{I2C_ADDR_SDO_LOW, I2C_ADDR_SDO_HIGH} {
+		conn, err := i2c.NewI2C(addr, line)
+		if err != nil {
+			return nil, nil, err
+		}
+		sensor, err := DetectBus(NewI2CBus(conn))
+		if err != nil {
+			lg.Debugf("No sensor recognized at address 0x%X: %v", addr, err)
+			conn.Close()
+			continue
+		}
+		return sensor, conn, nil
+	}
+	return nil, nil, fmt.Errorf("%w at addresses 0x%X, 0x%X on i2c-bus %d",
+		ErrNoSensor, I2C_ADDR_SDO_LOW, I2C_ADDR_SDO_HIGH, line)
+}
@@ -0,0 +1,144 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sentinel errors to check with errors.Is.
+var (
+	// ErrNotSupported is reported, when sensor lacks requested
+	// feature or setting (IIR filter on BMP180 and so on).
+	ErrNotSupported = errors.New("not supported")
+	// ErrMeasurementSkipped is reported on attempt to read quantity,
+	// which measurement is turned off by oversampling config.
+	ErrMeasurementSkipped = errors.New("measurement is skipped")
+	// ErrNoCalibration is reported, when calibration
+	// coefficients have not been read from sensor yet.
+	ErrNoCalibration = errors.New("calibration coefficients are not read")
+	// ErrNoSensor is reported by Probe and Detect, when
+	// no supported sensor is recognized.
+	ErrNoSensor = errors.New("no supported sensor found")
+)
+
+// ErrWrongChipID is returned, when identifier read from sensor
+// doesn't belong to expected sensor type. Might indicate wrong
+// sensor type selected, wrong address or bus noise.
+type ErrWrongChipID struct {
+	SensorType SensorType
+	// Identifiers valid for sensor type.
+	Expected []uint8
+	// Identifier read from sensor.
+	Actual uint8
+}
+
+// Implement error interface.
+func (v *ErrWrongChipID) Error() string {
+	return fmt.Sprintf("signature 0x%x doesn't belong to %v series", v.Actual, v.SensorType)
+}
+
+// ErrInvalidCalibration is returned, when calibration coefficient
+// read from sensor NVM looks corrupted (all bits cleared or set).
+type ErrInvalidCalibration struct {
+	// Coefficient name as in sensor specification.
+	Field string
+	Value uint16
+}
+
+// Implement error interface.
+func (v *ErrInvalidCalibration) Error() string {
+	return fmt.Sprintf("coefficient %s is invalid: 0x%X", v.Field, v.Value)
+}
+
+// ErrCalibrationMismatch is returned, when named parameter of stored
+// calibration record differs from one decoded from raw bytes. Indicates
+// record edited by hand or damaged.
+type ErrCalibrationMismatch struct {
+	// Coefficient name as in sensor specification.
+	Field string
+	// Value stored in named parameters.
+	Param int64
+	// Value decoded from raw bytes.
+	Raw int64
+}
+
+// Implement error interface.
+func (v *ErrCalibrationMismatch) Error() string {
+	return fmt.Sprintf("coefficient %s is %d, but raw calibration keeps %d",
+		v.Field, v.Param, v.Raw)
+}
+
+// ErrOutOfRange is returned, when raw ADC value doesn't fit
+// ADC resolution, or compensated value falls outside of sensor
+// operating range. Usually indicates corrupted calibration
+// coefficients or raw data, which can't be trusted.
+type ErrOutOfRange struct {
+	// Quantity name, prefixed with "raw" for ADC values.
+	Quantity string
+	Value    float64
+	// Valid range.
+	Min, Max float64
+}
+
+// Implement error interface.
+func (v *ErrOutOfRange) Error() string {
+	return fmt.Sprintf("%s %v is out of range [%v, %v]",
+		v.Quantity, v.Value, v.Min, v.Max)
+}
+
+// ErrConversionTimeout is returned when sensor doesn't complete
+// conversion in time, so output registers might keep stale data.
+type ErrConversionTimeout struct {
+	// Maximum conversion time according to sensor specification.
+	Expected time.Duration
+	// Time passed before giving up.
+	Waited time.Duration
+}
+
+// Implement error interface.
+func (v *ErrConversionTimeout) Error() string {
+	return fmt.Sprintf("sensor didn't complete conversion in %v (expected %v)",
+		v.Waited, v.Expected)
+}
+
+// ErrBusIO is returned, when bus transaction fails.
+// Underlying transport error is available with errors.Unwrap.
+type ErrBusIO struct {
+	// Either "read" or "write".
+	Op string
+	// Register addressed by transaction.
+	Reg byte
+	Err error
+}
+
+// Implement error interface.
+func (v *ErrBusIO) Error() string {
+	return fmt.Sprintf("bus %s of register 0x%02X failed: %v", v.Op, v.Reg, v.Err)
+}
+
+// Unwrap returns underlying transport error.
+func (v *ErrBusIO) Unwrap() error {
+	return v.Err
+}
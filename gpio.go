@@ -0,0 +1,159 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+//go:build linux
+// +build linux
+
+package bsbmp
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Linux GPIO character device ABI v1, see linux/gpio.h.
+const (
+	gpioGetLineEventIoctl = 0xC030B404 // _IOWR(0xB4, 0x04, struct gpioevent_request)
+
+	gpioHandleRequestInput  = 0x01
+	gpioEventRequestRising  = 0x01
+	gpioEventRequestFalling = 0x02
+	gpioEventRising         = 0x01
+)
+
+// gpioEventRequest reflect struct gpioevent_request from linux/gpio.h.
+type gpioEventRequest struct {
+	lineOffset    uint32
+	handleFlags   uint32
+	eventFlags    uint32
+	consumerLabel [32]byte
+	fd            int32
+}
+
+// gpioEventData reflect struct gpioevent_data from linux/gpio.h.
+type gpioEventData struct {
+	timestamp uint64
+	id        uint32
+	pad       uint32
+}
+
+// GPIOEvent is a single edge detected on GPIO line.
+type GPIOEvent struct {
+	// Kernel time stamp in nanoseconds.
+	Timestamp uint64
+	// Rising or falling edge.
+	RisingEdge bool
+}
+
+// GPIOWatcher deliver edges of GPIO line, connected to sensor INT pin,
+// via Linux GPIO character device, like /dev/gpiochip0. Only active edge
+// is reported, so with data ready interrupt enabled (see SetInterruptConfig)
+// each event means that new measurement might be read without
+// polling status register.
+type GPIOWatcher struct {
+	file   *os.File
+	events chan GPIOEvent
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewGPIOWatcher request GPIO line of chip device as input and start
+// to watch edges. Parameter activeHigh should match INT pin level
+// configured by InterruptConfigBMP388.
+func NewGPIOWatcher(device string, line uint32, activeHigh bool) (*GPIOWatcher, error) {
+	chip, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer chip.Close()
+	req := gpioEventRequest{
+		lineOffset:  line,
+		handleFlags: gpioHandleRequestInput,
+		eventFlags:  gpioEventRequestFalling,
+	}
+	if activeHigh {
+		req.eventFlags = gpioEventRequestRising
+	}
+	copy(req.consumerLabel[:], "bsbmp")
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, chip.Fd(),
+		gpioGetLineEventIoctl, uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return nil, errno
+	}
+	// Non-blocking descriptor is served by runtime poller,
+	// so Close interrupts pending read.
+	err = syscall.SetNonblock(int(req.fd), true)
+	if err != nil {
+		syscall.Close(int(req.fd))
+		return nil, err
+	}
+	v := &GPIOWatcher{
+		file:   os.NewFile(uintptr(req.fd), device),
+		events: make(chan GPIOEvent, 16),
+		done:   make(chan struct{}),
+	}
+	go v.watch()
+	return v, nil
+}
+
+// watch read line events, until watcher is closed.
+func (v *GPIOWatcher) watch() {
+	defer close(v.events)
+	var data gpioEventData
+	buf := (*[unsafe.Sizeof(data)]byte)(unsafe.Pointer(&data))[:]
+	for {
+		n, err := v.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				lg.Debugf("GPIO watcher stopped: %v", err)
+			}
+			return
+		}
+		if n < len(buf) {
+			continue
+		}
+		event := GPIOEvent{Timestamp: data.timestamp, RisingEdge: data.id == gpioEventRising}
+		select {
+		case v.events <- event:
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// Events returns channel, which receives line edges.
+// Channel is closed, once watcher is closed.
+func (v *GPIOWatcher) Events() <-chan GPIOEvent {
+	return v.events
+}
+
+// Close release GPIO line and stop watching.
+func (v *GPIOWatcher) Close() error {
+	var err error
+	v.once.Do(func() {
+		close(v.done)
+		err = v.file.Close()
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// Psychrometrics keeps quantities derived from temperature,
+// atmospheric pressure and relative humidity measured together.
+type Psychrometrics struct {
+	// Temperature in C (celsius), which air should be cooled to,
+	// to become saturated with water vapour.
+	DewPoint float64
+	// Temperature in C (celsius), which air should be cooled to,
+	// to become saturated with respect to ice. Equal to dew point,
+	// when the latter is above freezing.
+	FrostPoint float64
+	// Mass of water vapour in g per m^3 of air.
+	AbsoluteHumidity float64
+	// Mass of water vapour in g per kg of dry air.
+	// Zero, if pressure measurement is skipped.
+	MixingRatio float64
+	// Mass of water vapour in g per kg of moist air.
+	// Zero, if pressure measurement is skipped.
+	SpecificHumidity float64
+	// Partial pressure of water vapour in Pa.
+	VaporPressure float64
+	// Apparent temperature in C (celsius) according to US NWS.
+	HeatIndex float64
+	// Apparent temperature in C (celsius) according to Environment Canada.
+	Humidex float64
+}
+
+// Magnus formula coefficients recommended by WMO over water and ice.
+const (
+	magnusA      = 611.2
+	magnusWaterB = 17.62
+	magnusWaterC = 243.12
+	magnusIceB   = 22.46
+	magnusIceC   = 272.62
+	// Specific gas constant of water vapour in J/(kg*K).
+	vaporGasConstant = 461.5
+)
+
+// Psychrometrics calculates humidity derived quantities. Returns
+// ErrNotSupported, if humidity is not measured, and ErrOutOfRange
+// for zero humidity, where dew point is not defined.
+func (v *Measurement) Psychrometrics() (*Psychrometrics, error) {
+	if !v.HumiditySupported {
+		return nil, fmt.Errorf("humidity measurement is %w", ErrNotSupported)
+	}
+	if !(v.Humidity > 0 && v.Humidity <= 100) {
+		return nil, &ErrOutOfRange{Quantity: "humidity", Value: v.Humidity, Min: 0, Max: 100}
+	}
+	e := v.Humidity / 100 * saturationVaporPressure(v.Temperature)
+	// Magnus formula inverted, to get dew and frost points
+	gw := math.Log(e / magnusA)
+	p := &Psychrometrics{
+		DewPoint:         magnusWaterC * gw / (magnusWaterB - gw),
+		FrostPoint:       magnusIceC * gw / (magnusIceB - gw),
+		AbsoluteHumidity: e / (vaporGasConstant * (v.Temperature + kelvinOffset)) * 1000,
+		VaporPressure:    e,
+		HeatIndex:        heatIndex(v.Temperature, v.Humidity),
+		Humidex:          v.Temperature + 0.5555*(e/100-10),
+	}
+	if p.DewPoint >= 0 {
+		p.FrostPoint = p.DewPoint
+	}
+	if v.Pressure > 0 {
+		p.MixingRatio = vaporMassRatio * e / (v.Pressure - e) * 1000
+		p.SpecificHumidity = vaporMassRatio * e / (v.Pressure - (1-vaporMassRatio)*e) * 1000
+	}
+	return p, nil
+}
+
+// heatIndex calculates heat index in C (celsius) from temperature in C
+// and relative humidity in %RH, using US NWS algorithm: Steadman simple
+// formula, refined by Rothfusz regression with adjustments, when it's hot.
+func heatIndex(temperature, humidity float64) float64 {
+	t := temperature*9/5 + 32
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + humidity*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*humidity -
+			0.22475541*t*humidity - 0.00683783*t*t -
+			0.05481717*humidity*humidity + 0.00122874*t*t*humidity +
+			0.00085282*t*humidity*humidity - 0.00000199*t*t*humidity*humidity
+		if humidity < 13 && t >= 80 && t <= 112 {
+			hi -= (13 - humidity) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if humidity > 85 && t >= 80 && t <= 87 {
+			hi += (humidity - 85) / 10 * (87 - t) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
+}
@@ -0,0 +1,182 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"fmt"
+	"time"
+)
+
+// UseCase identify typical sensor application, for which Bosch Sensortec
+// recommends specific combination of power mode, oversampling,
+// IIR filter and standby time (see "Recommended modes of operation"
+// section of BMP280, BME280 and BMP388 datasheets).
+type UseCase int
+
+const (
+	USE_CASE_WEATHER_MONITORING UseCase = iota
+	USE_CASE_HUMIDITY_SENSING           // BME280 only
+	USE_CASE_INDOOR_NAVIGATION
+	USE_CASE_GAMING
+	USE_CASE_HANDHELD_DYNAMIC
+	USE_CASE_DROP_DETECTION
+	USE_CASE_ELEVATOR_DETECTION
+)
+
+// Implement Stringer interface.
+func (v UseCase) String() string {
+	switch v {
+	case USE_CASE_WEATHER_MONITORING:
+		return "weather monitoring"
+	case USE_CASE_HUMIDITY_SENSING:
+		return "humidity sensing"
+	case USE_CASE_INDOOR_NAVIGATION:
+		return "indoor navigation"
+	case USE_CASE_GAMING:
+		return "gaming"
+	case USE_CASE_HANDHELD_DYNAMIC:
+		return "handheld device dynamic"
+	case USE_CASE_DROP_DETECTION:
+		return "drop detection"
+	case USE_CASE_ELEVATOR_DETECTION:
+		return "elevator/floor change detection"
+	default:
+		return "!!! unknown !!!"
+	}
+}
+
+// Preset keeps full sensor configuration recommended for use case.
+type Preset struct {
+	// Normal mode if true, otherwise forced mode.
+	Normal bool
+	Config MeasureConfig
+	Filter IIRFilter
+	// Standby time between measurements in normal mode (sampling period
+	// for BMP388). In forced mode - recommended period of readings,
+	// which is up to application to follow.
+	Standby time.Duration
+}
+
+// Presets shared by BMP280 and BME280. BMP280 datasheet doesn't mention
+// gaming and humidity sensing, and BME280 datasheet doesn't mention
+// handheld, drop and elevator use cases, so settings are taken
+// from datasheet where use case is present.
+var bmx280Presets = map[UseCase]Preset{
+	USE_CASE_WEATHER_MONITORING: {false,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X1, OVERSAMPLING_X1},
+		IIR_FILTER_OFF, time.Minute},
+	USE_CASE_HUMIDITY_SENSING: {false,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_SKIPPED, OVERSAMPLING_X1},
+		IIR_FILTER_OFF, time.Second},
+	USE_CASE_INDOOR_NAVIGATION: {true,
+		MeasureConfig{OVERSAMPLING_X2, OVERSAMPLING_X16, OVERSAMPLING_X1},
+		IIR_FILTER_16, time.Millisecond / 2},
+	USE_CASE_GAMING: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X4, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_16, time.Millisecond / 2},
+	USE_CASE_HANDHELD_DYNAMIC: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X4, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_16, time.Millisecond / 2},
+	USE_CASE_DROP_DETECTION: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X2, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_OFF, time.Millisecond / 2},
+	USE_CASE_ELEVATOR_DETECTION: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X4, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_4, 125 * time.Millisecond},
+}
+
+// Presets taken from BMP388 datasheet rev. 1.1, table 9 "Recommended filter
+// settings based on use cases", which doesn't define settings for gaming
+// and elevator use cases. IIR filter coefficients there use the same scale
+// as table 7 "Noise in pressure" (off, 2, 4 ... 128), i.e. IIRFilter one:
+// coefficient 4 is register setting coef_3, not coef_7.
+var bmp388Presets = map[UseCase]Preset{
+	USE_CASE_WEATHER_MONITORING: {false,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X1, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_OFF, time.Minute},
+	USE_CASE_INDOOR_NAVIGATION: {true,
+		MeasureConfig{OVERSAMPLING_X2, OVERSAMPLING_X16, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_4, 40 * time.Millisecond},
+	USE_CASE_HANDHELD_DYNAMIC: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X4, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_4, 20 * time.Millisecond},
+	USE_CASE_DROP_DETECTION: {true,
+		MeasureConfig{OVERSAMPLING_X1, OVERSAMPLING_X2, OVERSAMPLING_SKIPPED},
+		IIR_FILTER_OFF, 10 * time.Millisecond},
+}
+
+// GetPreset returns settings recommended for use case, if they
+// are defined for sensor type. BMP180 has neither IIR filter
+// nor normal mode, so no presets are available for it.
+func GetPreset(sensorType SensorType, useCase UseCase) (*Preset, error) {
+	var presets map[UseCase]Preset
+	switch sensorType {
+	case BMP280, BME280:
+		presets = bmx280Presets
+	case BMP388:
+		presets = bmp388Presets
+	}
+	preset, ok := presets[useCase]
+	if ok && sensorType == BMP280 {
+		if preset.Config.Pressure == OVERSAMPLING_SKIPPED {
+			// Nothing left to measure without humidity
+			ok = false
+		}
+		preset.Config.Humidity = OVERSAMPLING_SKIPPED
+	}
+	if !ok {
+		return nil, fmt.Errorf("%v use case is %w by %v", useCase, ErrNotSupported, sensorType)
+	}
+	return &preset, nil
+}
+
+// ApplyPreset configures sensor with settings recommended for use case:
+// oversampling, IIR filter and power mode. In normal mode following
+// Read... methods return latest data, in forced mode each reading
+// start conversion with preset oversampling.
+func (v *BMP) ApplyPreset(useCase UseCase) error {
+	preset, err := GetPreset(v.sensorType, useCase)
+	if err != nil {
+		return err
+	}
+	lg.Debugf("Apply %v preset: %+v", useCase, preset)
+	err = v.SetForcedMode()
+	if err != nil {
+		return err
+	}
+	err = v.SetMeasureConfig(&preset.Config)
+	if err != nil {
+		return err
+	}
+	err = v.SetIIRFilter(preset.Filter)
+	if err != nil {
+		return err
+	}
+	if preset.Normal {
+		// Accuracy is ignored, since config is set
+		err = v.SetNormalMode(ACCURACY_STANDARD, preset.Standby)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
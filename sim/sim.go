@@ -0,0 +1,608 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+// Package sim emulates register maps of Bosch Sensortec BMP180, BMP280,
+// BME280 and BMP388 sensors in memory. Device type implements bsbmp.Bus
+// interface, so whole driver might be exercised without real hardware:
+//
+//	dev := sim.NewBMP280()
+//	dev.SetRaw(519888, 415148, 0)
+//	sensor, err := bsbmp.NewBMPBus(bsbmp.BMP280, dev)
+package sim
+
+import (
+	"sync"
+)
+
+// Chip identify which sensor register map is emulated.
+type Chip int
+
+const (
+	// Bosch Sensortec BMP180 register map.
+	BMP180 Chip = iota
+	// Bosch Sensortec BMP280 register map.
+	BMP280
+	// Bosch Sensortec BME280 register map.
+	BME280
+	// Bosch Sensortec BMP388 register map.
+	BMP388
+)
+
+// Implement Stringer interface.
+func (v Chip) String() string {
+	switch v {
+	case BMP180:
+		return "BMP180"
+	case BMP280:
+		return "BMP280"
+	case BME280:
+		return "BME280"
+	case BMP388:
+		return "BMP388"
+	default:
+		return "!!! unknown !!!"
+	}
+}
+
+// Registers and values of emulated sensors.
+const (
+	bmp180IDReg     = 0xD0
+	bmp180CtrlMeas  = 0xF4
+	bmp180Out       = 0xF6
+	bmp180CoefStart = 0xAA
+	bmp180SCO       = 0x20
+
+	bmp280IDReg     = 0xD0
+	bmp280Reset     = 0xE0
+	bmp280CtrlHum   = 0xF2
+	bmp280Status    = 0xF3
+	bmp280CtrlMeas  = 0xF4
+	bmp280Config    = 0xF5
+	bmp280PressOut  = 0xF7
+	bmp280TempOut   = 0xFA
+	bmp280HumOut    = 0xFD
+	bmp280CoefStart = 0x88
+	bme280CoefH1    = 0xA1
+	bme280CoefH2    = 0xE1
+	bmp280Measuring = 0x08
+
+	bmp388IDReg     = 0x00
+	bmp388Status    = 0x03
+	bmp388PressOut  = 0x04
+	bmp388TempOut   = 0x07
+	bmp388IntStatus = 0x11
+	bmp388FIFOLen   = 0x12
+	bmp388FIFOData  = 0x14
+	bmp388FIFOWtm   = 0x15
+	bmp388FIFOCfg1  = 0x17
+	bmp388FIFOCfg2  = 0x18
+	bmp388IntCtrl   = 0x19
+	bmp388PwrCtrl   = 0x1B
+	bmp388CoefStart = 0x31
+	bmp388Cmd       = 0x7E
+	bmp388CmdRdy    = 0x10
+	bmp388DrdyPress = 0x20
+	bmp388DrdyTemp  = 0x40
+	bmp388IntFwm    = 0x01
+	bmp388IntFfull  = 0x02
+	bmp388IntDrdy   = 0x08
+	bmp388FIFOFlush = 0xB0
+	bmp388FIFOSize  = 512
+
+	softResetCmd = 0xB6
+)
+
+// Calibration blocks taken from datasheet examples, so that
+// compensated values for default raw readings are well known.
+var (
+	// BMP180 datasheet, chapter 3.5: AC1..MD, big-endian.
+	defaultCoeffBMP180 = []byte{
+		0x01, 0x98, 0xFF, 0xB8, 0xC7, 0xD1, 0x7F, 0xE5, 0x7F, 0xF5,
+		0x5A, 0x71, 0x18, 0x2E, 0x00, 0x04, 0x80, 0x00, 0xDD, 0xF9,
+		0x0B, 0x34,
+	}
+	// BMP280 datasheet, chapter 8.2: dig_T1..dig_P9, little-endian.
+	defaultCoeffBMP280 = []byte{
+		0x70, 0x6B, 0x43, 0x67, 0x18, 0xFC, 0x7D, 0x8E, 0x43, 0xD6,
+		0xD0, 0x0B, 0x27, 0x0B, 0x8C, 0x00, 0xF9, 0xFF, 0x8C, 0x3C,
+		0xF8, 0xC6, 0x70, 0x17,
+	}
+	// BME280 humidity parameters dig_H1 (0xA1) and
+	// dig_H2..dig_H6 (0xE1..0xE7) of real sensor.
+	defaultCoeffBME280H1 = []byte{0x4B}
+	defaultCoeffBME280H2 = []byte{0x6A, 0x01, 0x00, 0x13, 0x29, 0x03, 0x1E}
+	// BMP388 NVM_PAR_T1..NVM_PAR_P11 of real sensor, little-endian.
+	defaultCoeffBMP388 = []byte{
+		0x7C, 0x6C, 0x04, 0x4B, 0xF9, 0x73, 0xFB, 0xCC, 0xF4, 0x23,
+		0x01, 0x0E, 0x60, 0xDF, 0x74, 0x03, 0xFB, 0x2A, 0x3A, 0x05,
+		0xC4,
+	}
+)
+
+// Device emulate single sensor attached to the bus.
+// It's safe to use Device from multiple goroutines.
+type Device struct {
+	mu   sync.Mutex
+	chip Chip
+	regs [256]byte
+	// Raw ADC values reported by next conversion
+	rawT, rawP, rawH int32
+	// How many status polls report "busy" after conversion start
+	busyPolls int
+	// Remaining status polls reporting "busy"
+	busy int
+	// Error returned by any bus access, if set
+	err error
+	// BMP388 FIFO content and conversions counter used for subsampling
+	fifo        []byte
+	conversions int
+	// BMP388 sensor time, incremented by each conversion
+	sensorTime uint32
+}
+
+// NewBMP180 creates emulated BMP180 preloaded with datasheet
+// calibration and raw values: UT=27898, UP=23843 (oss=0),
+// which gives 15.0 *C and 69964 Pa.
+func NewBMP180() *Device {
+	v := &Device{chip: BMP180, rawT: 27898, rawP: 23843, busyPolls: 2}
+	v.reset()
+	return v
+}
+
+// NewBMP280 creates emulated BMP280 preloaded with datasheet
+// calibration and raw values: adc_T=519888, adc_P=415148,
+// which gives 25.08 *C and 100653.27 Pa.
+func NewBMP280() *Device {
+	v := &Device{chip: BMP280, rawT: 519888, rawP: 415148, busyPolls: 2}
+	v.reset()
+	return v
+}
+
+// NewBME280 creates emulated BME280 preloaded with datasheet
+// temperature and pressure calibration and raw values of BMP280
+// (see NewBMP280) and humidity calibration of real sensor.
+func NewBME280() *Device {
+	v := &Device{chip: BME280, rawT: 519888, rawP: 415148, rawH: 30000, busyPolls: 2}
+	v.reset()
+	return v
+}
+
+// NewBMP388 creates emulated BMP388 preloaded with calibration
+// of real sensor and raw values: ADC_T=8382464, ADC_P=6212880,
+// which gives about 22.72 *C and 100000 Pa.
+func NewBMP388() *Device {
+	v := &Device{chip: BMP388, rawT: 8382464, rawP: 6212880, busyPolls: 2}
+	v.reset()
+	return v
+}
+
+// Chip returns emulated sensor model.
+func (v *Device) Chip() Chip {
+	return v.chip
+}
+
+// SetRaw define uncompensated ADC values returned by next conversions.
+// Humidity is ignored by sensors other than BME280. BMP180 pressure
+// should be specified as 19-bit value, which is shifted according
+// to oversampling setting requested by driver.
+func (v *Device) SetRaw(temperature, pressure, humidity int32) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rawT, v.rawP, v.rawH = temperature, pressure, humidity
+	if v.continuous() && v.busy == 0 {
+		// Normal mode: next measurement has already completed
+		v.complete()
+	}
+}
+
+// SetBusyPolls define how many status register reads
+// report conversion in progress after conversion start.
+func (v *Device) SetBusyPolls(polls int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.busyPolls = polls
+}
+
+// SetError make each following bus access fail with err.
+// Pass nil to restore normal operation.
+func (v *Device) SetError(err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.err = err
+}
+
+// SetCalibration replace calibration block starting from register.
+func (v *Device) SetCalibration(reg byte, data []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	copy(v.regs[reg:], data)
+}
+
+// Register returns current register value without side effects.
+func (v *Device) Register(reg byte) byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.regs[reg]
+}
+
+// SetRegister change register value without side effects.
+func (v *Device) SetRegister(reg byte, value byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.regs[reg] = value
+}
+
+// ReadRegU8 reads single byte from register.
+func (v *Device) ReadRegU8(reg byte) (byte, error) {
+	buf, err := v.ReadRegBytes(reg, 1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// ReadRegBytes reads block of n bytes starting from register.
+func (v *Device) ReadRegBytes(reg byte, n int) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.err != nil {
+		return nil, v.err
+	}
+	if v.isStatusReg(reg) {
+		v.pollStatus()
+	}
+	if v.chip == BMP388 && reg == bmp388FIFOData {
+		return v.readFIFO(n), nil
+	}
+	buf := make([]byte, n)
+	for i := range buf {
+		// Register address auto-increment
+		buf[i] = v.regs[(int(reg)+i)&0xFF]
+	}
+	if v.chip == BMP388 && reg <= bmp388IntStatus && int(reg)+n > bmp388IntStatus {
+		// Interrupt flags are cleared on read
+		v.regs[bmp388IntStatus] = 0
+	}
+	return buf, nil
+}
+
+// WriteRegU8 writes single byte to register.
+func (v *Device) WriteRegU8(reg byte, value byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.err != nil {
+		return v.err
+	}
+	switch v.chip {
+	case BMP180:
+		v.writeBMP180(reg, value)
+	case BMP280, BME280:
+		v.writeBMP280(reg, value)
+	case BMP388:
+		v.writeBMP388(reg, value)
+	}
+	return nil
+}
+
+// reset restore power-on register values.
+func (v *Device) reset() {
+	v.regs = [256]byte{}
+	v.busy = 0
+	v.fifo = nil
+	v.conversions = 0
+	switch v.chip {
+	case BMP180:
+		v.regs[bmp180IDReg] = 0x55
+		copy(v.regs[bmp180CoefStart:], defaultCoeffBMP180)
+	case BMP280:
+		v.regs[bmp280IDReg] = 0x58
+		copy(v.regs[bmp280CoefStart:], defaultCoeffBMP280)
+		v.regs[bmp280PressOut] = 0x80
+		v.regs[bmp280TempOut] = 0x80
+	case BME280:
+		v.regs[bmp280IDReg] = 0x60
+		copy(v.regs[bmp280CoefStart:], defaultCoeffBMP280)
+		copy(v.regs[bme280CoefH1:], defaultCoeffBME280H1)
+		copy(v.regs[bme280CoefH2:], defaultCoeffBME280H2)
+		v.regs[bmp280PressOut] = 0x80
+		v.regs[bmp280TempOut] = 0x80
+		v.regs[bmp280HumOut] = 0x80
+	case BMP388:
+		v.regs[bmp388IDReg] = 0x50
+		v.regs[bmp388IntCtrl] = 0x02
+		v.regs[bmp388Status] = bmp388CmdRdy
+		copy(v.regs[bmp388CoefStart:], defaultCoeffBMP388)
+	}
+}
+
+func (v *Device) isStatusReg(reg byte) bool {
+	switch v.chip {
+	case BMP180:
+		return reg == bmp180CtrlMeas
+	case BMP280, BME280:
+		return reg == bmp280Status
+	case BMP388:
+		return reg == bmp388Status
+	}
+	return false
+}
+
+// continuous verify that sensor is in normal power mode.
+func (v *Device) continuous() bool {
+	switch v.chip {
+	case BMP280, BME280:
+		return v.regs[bmp280CtrlMeas]&0x03 == 0x03
+	case BMP388:
+		return v.regs[bmp388PwrCtrl]&0x30 == 0x30
+	}
+	return false
+}
+
+// pollStatus count down conversion time and
+// complete conversion once it's elapsed.
+func (v *Device) pollStatus() {
+	if v.busy > 0 {
+		v.busy--
+		if v.busy == 0 {
+			v.complete()
+		}
+	}
+}
+
+// start begin conversion, which completes immediately
+// or after configured amount of status polls.
+func (v *Device) start() {
+	v.busy = v.busyPolls
+	switch v.chip {
+	case BMP180:
+		v.regs[bmp180CtrlMeas] |= bmp180SCO
+	case BMP280, BME280:
+		v.regs[bmp280Status] |= bmp280Measuring
+	case BMP388:
+		v.regs[bmp388Status] &^= bmp388DrdyPress | bmp388DrdyTemp
+	}
+	if v.busy == 0 {
+		v.complete()
+	}
+}
+
+// complete update data registers and status flags.
+func (v *Device) complete() {
+	switch v.chip {
+	case BMP180:
+		v.completeBMP180()
+	case BMP280, BME280:
+		v.completeBMP280()
+	case BMP388:
+		v.completeBMP388()
+	}
+}
+
+func (v *Device) writeBMP180(reg byte, value byte) {
+	switch reg {
+	case bmp280Reset:
+		if value == softResetCmd {
+			v.reset()
+		}
+	case bmp180CtrlMeas:
+		v.regs[reg] = value
+		if value&0x1F == 0x0E || value&0x1F == 0x0F || value&0x1F == 0x14 {
+			v.start()
+		}
+	default:
+		v.regs[reg] = value
+	}
+}
+
+func (v *Device) completeBMP180() {
+	ctrl := v.regs[bmp180CtrlMeas]
+	if ctrl&0x1F == 0x14 {
+		// Pressure, shifted according to oversampling setting
+		oss := ctrl >> 6
+		up := uint32(v.rawP) << (8 - oss)
+		v.regs[bmp180Out] = byte(up >> 16)
+		v.regs[bmp180Out+1] = byte(up >> 8)
+		v.regs[bmp180Out+2] = byte(up)
+	} else {
+		// Temperature
+		v.regs[bmp180Out] = byte(v.rawT >> 8)
+		v.regs[bmp180Out+1] = byte(v.rawT)
+		v.regs[bmp180Out+2] = 0
+	}
+	v.regs[bmp180CtrlMeas] &^= bmp180SCO
+}
+
+func (v *Device) writeBMP280(reg byte, value byte) {
+	switch reg {
+	case bmp280Reset:
+		if value == softResetCmd {
+			v.reset()
+		}
+	case bmp280CtrlMeas:
+		v.regs[reg] = value
+		if value&0x03 != 0 {
+			// Forced or normal mode
+			v.start()
+		}
+	case bmp280Status:
+		// Read-only register
+	case bmp280Config:
+		// Writes in normal mode might be ignored by sensor,
+		// emulate worst case.
+		if !v.continuous() {
+			v.regs[reg] = value
+		}
+	default:
+		v.regs[reg] = value
+	}
+}
+
+func (v *Device) completeBMP280() {
+	ctrl := v.regs[bmp280CtrlMeas]
+	// Skipped measurements report 0x80000 (0x8000 for humidity)
+	ut, up, uh := int32(0x80000), int32(0x80000), int32(0x8000)
+	if ctrl>>5 != 0 {
+		ut = v.rawT
+	}
+	if (ctrl>>2)&0x07 != 0 {
+		up = v.rawP
+	}
+	if v.chip == BME280 && v.regs[bmp280CtrlHum]&0x07 != 0 {
+		uh = v.rawH
+	}
+	v.regs[bmp280PressOut] = byte(up >> 12)
+	v.regs[bmp280PressOut+1] = byte(up >> 4)
+	v.regs[bmp280PressOut+2] = byte(up<<4) & 0xF0
+	v.regs[bmp280TempOut] = byte(ut >> 12)
+	v.regs[bmp280TempOut+1] = byte(ut >> 4)
+	v.regs[bmp280TempOut+2] = byte(ut<<4) & 0xF0
+	if v.chip == BME280 {
+		v.regs[bmp280HumOut] = byte(uh >> 8)
+		v.regs[bmp280HumOut+1] = byte(uh)
+	}
+	v.regs[bmp280Status] &^= bmp280Measuring
+	if ctrl&0x03 != 0x03 {
+		// Forced mode: return to sleep mode
+		v.regs[bmp280CtrlMeas] = ctrl &^ 0x03
+	}
+}
+
+func (v *Device) writeBMP388(reg byte, value byte) {
+	switch reg {
+	case bmp388Cmd:
+		switch value {
+		case softResetCmd:
+			v.reset()
+		case bmp388FIFOFlush:
+			v.fifo = nil
+			v.updateFIFOLength()
+		}
+	case bmp388PwrCtrl:
+		v.regs[reg] = value
+		if value&0x30 != 0 {
+			// Forced or normal mode
+			v.start()
+		}
+	case bmp388Status, bmp388IntStatus:
+		// Read-only register
+	default:
+		v.regs[reg] = value
+	}
+}
+
+func (v *Device) completeBMP388() {
+	pwr := v.regs[bmp388PwrCtrl]
+	if pwr&0x01 != 0 {
+		v.regs[bmp388PressOut] = byte(v.rawP)
+		v.regs[bmp388PressOut+1] = byte(v.rawP >> 8)
+		v.regs[bmp388PressOut+2] = byte(v.rawP >> 16)
+		v.regs[bmp388Status] |= bmp388DrdyPress
+	}
+	if pwr&0x02 != 0 {
+		v.regs[bmp388TempOut] = byte(v.rawT)
+		v.regs[bmp388TempOut+1] = byte(v.rawT >> 8)
+		v.regs[bmp388TempOut+2] = byte(v.rawT >> 16)
+		v.regs[bmp388Status] |= bmp388DrdyTemp
+	}
+	v.sensorTime = (v.sensorTime + 1) & 0xFFFFFF
+	v.regs[bmp388IntStatus] |= bmp388IntDrdy
+	if pwr&0x30 != 0x30 {
+		// Forced mode: return to sleep mode
+		v.regs[bmp388PwrCtrl] = pwr &^ 0x30
+	} else if v.regs[bmp388FIFOCfg1]&0x01 != 0 {
+		v.pushFIFO()
+	}
+}
+
+// pushFIFO append frame with latest conversion to BMP388 FIFO.
+func (v *Device) pushFIFO() {
+	cfg1, pwr := v.regs[bmp388FIFOCfg1], v.regs[bmp388PwrCtrl]
+	v.conversions++
+	if (v.conversions-1)%(1<<(v.regs[bmp388FIFOCfg2]&0x07)) != 0 {
+		// Subsampling: skip conversion
+		return
+	}
+	temp := cfg1&0x10 != 0 && pwr&0x02 != 0
+	press := cfg1&0x08 != 0 && pwr&0x01 != 0
+	var frame []byte
+	switch {
+	case temp && press:
+		frame = []byte{0x94, byte(v.rawT), byte(v.rawT >> 8), byte(v.rawT >> 16),
+			byte(v.rawP), byte(v.rawP >> 8), byte(v.rawP >> 16)}
+	case temp:
+		frame = []byte{0x90, byte(v.rawT), byte(v.rawT >> 8), byte(v.rawT >> 16)}
+	case press:
+		frame = []byte{0x84, byte(v.rawP), byte(v.rawP >> 8), byte(v.rawP >> 16)}
+	default:
+		return
+	}
+	for len(v.fifo)+len(frame) > bmp388FIFOSize {
+		v.regs[bmp388IntStatus] |= bmp388IntFfull
+		if cfg1&0x02 != 0 {
+			// Stop on full: drop new frame
+			return
+		}
+		// Overwrite: drop oldest frame
+		v.fifo = v.fifo[fifoFrameSize(v.fifo[0]):]
+	}
+	v.fifo = append(v.fifo, frame...)
+	v.updateFIFOLength()
+	wtm := int(v.regs[bmp388FIFOWtm+1]&0x01)<<8 | int(v.regs[bmp388FIFOWtm])
+	if wtm > 0 && len(v.fifo) >= wtm {
+		v.regs[bmp388IntStatus] |= bmp388IntFwm
+	}
+}
+
+// fifoFrameSize returns size of BMP388 sensor frame including header.
+func fifoFrameSize(header byte) int {
+	if header == 0x94 {
+		return 7
+	}
+	return 4
+}
+
+// readFIFO pops n bytes from BMP388 FIFO. Once FIFO is drained,
+// sensor time frame (if enabled) and empty frames are returned.
+func (v *Device) readFIFO(n int) []byte {
+	buf := make([]byte, 0, n)
+	k := len(v.fifo)
+	if k > n {
+		k = n
+	}
+	buf = append(buf, v.fifo[:k]...)
+	v.fifo = v.fifo[k:]
+	if len(buf) < n && v.regs[bmp388FIFOCfg1]&0x04 != 0 {
+		t := v.sensorTime
+		buf = append(buf, 0xA0, byte(t), byte(t>>8), byte(t>>16))
+	}
+	for len(buf) < n {
+		buf = append(buf, 0x80, 0x00)
+	}
+	v.updateFIFOLength()
+	return buf[:n]
+}
+
+// updateFIFOLength reflects FIFO fill level in BMP388 registers.
+func (v *Device) updateFIFOLength() {
+	v.regs[bmp388FIFOLen] = byte(len(v.fifo))
+	// Byte counter is 9 bits wide
+	v.regs[bmp388FIFOLen+1] = byte(len(v.fifo)>>8) & 0x01
+}
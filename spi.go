@@ -0,0 +1,232 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+//go:build linux
+// +build linux
+
+package bsbmp
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Linux spidev ioctl requests, see linux/spi/spidev.h.
+const (
+	spiIocWrMode        = 0x40016B01 // _IOW('k', 1, __u8)
+	spiIocWrBitsPerWord = 0x40016B03 // _IOW('k', 3, __u8)
+	spiIocWrMaxSpeedHz  = 0x40046B04 // _IOW('k', 4, __u32)
+	spiIocMessage1      = 0x40206B00 // _IOW('k', 0, char[1*32])
+	spiIocMessage2      = 0x40406B00 // _IOW('k', 0, char[2*32])
+
+	spiMode0     = 0x00 // CPOL=0, CPHA=0
+	spiMode3Wire = 0x10 // SI/SO signals shared
+)
+
+// SPI specific bits of register address byte.
+const (
+	SPI_READ_BIT   = 0x80
+	SPI_WRITE_MASK = 0x7F
+)
+
+// Registers and bits enabling 3-wire SPI interface on sensor side.
+const (
+	BMP280_SPI3W_EN = 0x01 // bit 0 of BMP280_CONFIG/BME280_CONFIG
+	BMP388_IF_CONF  = 0x1A
+	BMP388_SPI3_EN  = 0x01 // bit 0 of BMP388_IF_CONF
+)
+
+// spiIocTransfer reflect struct spi_ioc_transfer from linux/spi/spidev.h.
+type spiIocTransfer struct {
+	txBuf          uint64
+	rxBuf          uint64
+	length         uint32
+	speedHz        uint32
+	delayUsecs     uint16
+	bitsPerWord    uint8
+	csChange       uint8
+	txNbits        uint8
+	rxNbits        uint8
+	wordDelayUsecs uint8
+	pad            uint8
+}
+
+// SPI implements Bus interface on top of Linux spidev device,
+// like /dev/spidev0.0. Supports both 4-wire and 3-wire modes.
+// BMP180 doesn't have SPI interface.
+type SPI struct {
+	file    *os.File
+	speedHz uint32
+	// Amount of dummy bytes sent by sensor before data on read:
+	// BMP388 return one dummy byte, BMP280 and BME280 - none.
+	dummyBytes int
+}
+
+// Static cast to verify at compile time
+// that type implement interface.
+var _ Bus = &SPI{}
+
+// NewSPI opens spidev device to communicate with sensor, selected by
+// chip select line which is bound to device file. Parameter threeWire
+// define whether SDI and SDO lines are joined (3-wire mode),
+// in that case sensor is switched to 3-wire mode as well.
+func NewSPI(device string, sensorType SensorType, speedHz uint32, threeWire bool) (*SPI, error) {
+	v := &SPI{speedHz: speedHz}
+	switch sensorType {
+	case BMP280, BME280:
+		v.dummyBytes = 0
+	case BMP388:
+		v.dummyBytes = 1
+	default:
+		return nil, fmt.Errorf("SPI interface is %w by %v", ErrNotSupported, sensorType)
+	}
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	v.file = f
+
+	var mode uint8 = spiMode0
+	if threeWire {
+		mode |= spiMode3Wire
+	}
+	err = v.ioctl(spiIocWrMode, unsafe.Pointer(&mode))
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+	var bits uint8 = 8
+	err = v.ioctl(spiIocWrBitsPerWord, unsafe.Pointer(&bits))
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+	err = v.ioctl(spiIocWrMaxSpeedHz, unsafe.Pointer(&speedHz))
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+
+	if threeWire {
+		// Write transactions use SDI line only, so it's safe
+		// to switch sensor to 3-wire mode right here.
+		switch sensorType {
+		case BMP280:
+			err = v.WriteRegU8(BMP280_CONFIG, BMP280_SPI3W_EN)
+		case BME280:
+			err = v.WriteRegU8(BME280_CONFIG, BMP280_SPI3W_EN)
+		case BMP388:
+			err = v.WriteRegU8(BMP388_IF_CONF, BMP388_SPI3_EN)
+		}
+		if err != nil {
+			v.Close()
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Close releases spidev device.
+func (v *SPI) Close() error {
+	return v.file.Close()
+}
+
+// ioctl issues request with argument passed by pointer. Pointer is
+// converted to uintptr within syscall expression only, so that
+// argument is kept alive and not moved until syscall returns.
+func (v *SPI) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, v.file.Fd(), req, uintptr(arg))
+	runtime.KeepAlive(v.file)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// heapBytes allocates buffer, which escapes to heap, thus never moves,
+// while kernel access it by address stored in spiIocTransfer as integer.
+//
+//go:noinline
+func heapBytes(n int) []byte {
+	return make([]byte, n)
+}
+
+// ReadRegU8 reads single byte from register.
+func (v *SPI) ReadRegU8(reg byte) (byte, error) {
+	buf, err := v.ReadRegBytes(reg, 1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// ReadRegBytes reads block of n bytes starting from register.
+// Register address is sent with read bit set, then sensor
+// auto-increment address, while data is clocked out.
+func (v *SPI) ReadRegBytes(reg byte, n int) ([]byte, error) {
+	tx := heapBytes(1)
+	tx[0] = reg | SPI_READ_BIT
+	rx := heapBytes(v.dummyBytes + n)
+	// Two transfers in one message keep chip select active,
+	// and let kernel turn line direction around in 3-wire mode.
+	xfer := [2]spiIocTransfer{
+		{
+			txBuf:       uint64(uintptr(unsafe.Pointer(&tx[0]))),
+			length:      uint32(len(tx)),
+			speedHz:     v.speedHz,
+			bitsPerWord: 8,
+		},
+		{
+			rxBuf:       uint64(uintptr(unsafe.Pointer(&rx[0]))),
+			length:      uint32(len(rx)),
+			speedHz:     v.speedHz,
+			bitsPerWord: 8,
+		},
+	}
+	err := v.ioctl(spiIocMessage2, unsafe.Pointer(&xfer[0]))
+	// Buffers are referenced by integer addresses only
+	runtime.KeepAlive(tx)
+	runtime.KeepAlive(rx)
+	if err != nil {
+		return nil, err
+	}
+	// Skip dummy byte(s) preceding data
+	return rx[v.dummyBytes:], nil
+}
+
+// WriteRegU8 writes single byte to register.
+// Register address is sent with read bit cleared.
+func (v *SPI) WriteRegU8(reg byte, value byte) error {
+	tx := heapBytes(2)
+	tx[0], tx[1] = reg&SPI_WRITE_MASK, value
+	xfer := spiIocTransfer{
+		txBuf:       uint64(uintptr(unsafe.Pointer(&tx[0]))),
+		length:      uint32(len(tx)),
+		speedHz:     v.speedHz,
+		bitsPerWord: 8,
+	}
+	err := v.ioctl(spiIocMessage1, unsafe.Pointer(&xfer))
+	runtime.KeepAlive(tx)
+	return err
+}
@@ -0,0 +1,165 @@
+/*
+ * Reference compensation used to produce golden vectors of bmp_test.go.
+ *
+ * BME280 humidity: BME280_compensate_H_int32 (datasheet BST-BME280-DS001,
+ * chapter 4.2.3) and compensate_humidity_double (chapter 8.1), temperature
+ * t_fine from chapter 4.2.3 and 8.1 of the same datasheet.
+ *
+ * BMP388 integer: compensate_temperature and compensate_pressure of
+ * Bosch Sensortec BMP3 Sensor API (bmp3.c, 64-bit integer variant).
+ * BMP388 double: compensation formulas and coefficient quantization of
+ * datasheet BST-BMP388-DS001, chapter 9 (same as BMP3_DOUBLE_PRECISION_COMPENSATION
+ * variant of BMP3 Sensor API).
+ *
+ * Build and run: cc -o /tmp/compensate compensate.c && /tmp/compensate
+ */
+#include <stdint.h>
+#include <stdio.h>
+#include <math.h>
+
+static int16_t s16(const uint8_t *b) { return (int16_t)(b[0] | b[1] << 8); }
+static uint16_t u16(const uint8_t *b) { return (uint16_t)(b[0] | b[1] << 8); }
+
+/* BME280: dig_T1..dig_P9 (0x88..0x9F), dig_H1 (0xA1), then 0xE1..0xE7,
+ * same layout as calibration block of package. */
+static void bme280(const uint8_t *c, int32_t adc_T, int32_t adc_H)
+{
+	uint16_t dig_T1 = u16(c);
+	int16_t dig_T2 = s16(c + 2), dig_T3 = s16(c + 4);
+	uint8_t dig_H1 = c[24];
+	int16_t dig_H2 = s16(c + 25);
+	uint8_t dig_H3 = c[27];
+	int16_t dig_H4 = (int16_t)((int8_t)c[28] * 16) | (int16_t)(c[29] & 0x0F);
+	int16_t dig_H5 = (int16_t)((int8_t)c[30] * 16) | (int16_t)(c[29] >> 4);
+	int8_t dig_H6 = (int8_t)c[31];
+
+	/* chapter 4.2.3 */
+	int32_t var1 = ((((adc_T >> 3) - ((int32_t)dig_T1 << 1))) * ((int32_t)dig_T2)) >> 11;
+	int32_t var2 = (((((adc_T >> 4) - ((int32_t)dig_T1)) * ((adc_T >> 4) - ((int32_t)dig_T1))) >> 12) *
+			((int32_t)dig_T3)) >> 14;
+	int32_t t_fine = var1 + var2;
+	int32_t v_x1_u32r = (t_fine - ((int32_t)76800));
+	v_x1_u32r = (((((adc_H << 14) - (((int32_t)dig_H4) << 20) - (((int32_t)dig_H5) * v_x1_u32r)) +
+			((int32_t)16384)) >> 15) * (((((((v_x1_u32r * ((int32_t)dig_H6)) >> 10) *
+			(((v_x1_u32r * ((int32_t)dig_H3)) >> 11) + ((int32_t)32768))) >> 10) +
+			((int32_t)2097152)) * ((int32_t)dig_H2) + 8192) >> 14));
+	v_x1_u32r = (v_x1_u32r - (((((v_x1_u32r >> 15) * (v_x1_u32r >> 15)) >> 7) * ((int32_t)dig_H1)) >> 4));
+	v_x1_u32r = (v_x1_u32r < 0 ? 0 : v_x1_u32r);
+	v_x1_u32r = (v_x1_u32r > 419430400 ? 419430400 : v_x1_u32r);
+	uint32_t hum = (uint32_t)(v_x1_u32r >> 12);
+
+	/* chapter 8.1 */
+	double dvar1 = (((double)adc_T) / 16384.0 - ((double)dig_T1) / 1024.0) * ((double)dig_T2);
+	double dvar2 = ((((double)adc_T) / 131072.0 - ((double)dig_T1) / 8192.0) *
+			(((double)adc_T) / 131072.0 - ((double)dig_T1) / 8192.0)) * ((double)dig_T3);
+	double t_fine_d = dvar1 + dvar2;
+	double var_H = (t_fine_d - 76800.0);
+	var_H = (adc_H - (((double)dig_H4) * 64.0 + ((double)dig_H5) / 16384.0 * var_H)) *
+		(((double)dig_H2) / 65536.0 * (1.0 + ((double)dig_H6) / 67108864.0 * var_H *
+		(1.0 + ((double)dig_H3) / 67108864.0 * var_H)));
+	var_H = var_H * (1.0 - ((double)dig_H1) * var_H / 524288.0);
+	if (var_H > 100.0)
+		var_H = 100.0;
+	else if (var_H < 0.0)
+		var_H = 0.0;
+	printf("BME280 adc_T=%d adc_H=%d: humidity %.6f, double %.6f\n",
+	       adc_T, adc_H, hum / 1024.0, var_H);
+}
+
+/* BMP388: NVM_PAR_T1..NVM_PAR_P11, 21 bytes starting from 0x31. */
+static void bmp388(const uint8_t *c, uint32_t ut, uint32_t up)
+{
+	uint16_t par_t1 = u16(c), par_t2 = u16(c + 2);
+	int8_t par_t3 = (int8_t)c[4];
+	int16_t par_p1 = s16(c + 5), par_p2 = s16(c + 7);
+	int8_t par_p3 = (int8_t)c[9], par_p4 = (int8_t)c[10];
+	uint16_t par_p5 = u16(c + 11), par_p6 = u16(c + 13);
+	int8_t par_p7 = (int8_t)c[15], par_p8 = (int8_t)c[16];
+	int16_t par_p9 = s16(c + 17);
+	int8_t par_p10 = (int8_t)c[19], par_p11 = (int8_t)c[20];
+
+	/* compensate_temperature */
+	int64_t partial_data1, partial_data2, partial_data3, partial_data4, partial_data5, partial_data6;
+	partial_data1 = (int64_t)(ut - ((int64_t)256 * par_t1));
+	partial_data2 = (int64_t)(par_t2 * partial_data1);
+	partial_data3 = (int64_t)(partial_data1 * partial_data1);
+	partial_data4 = (int64_t)partial_data3 * par_t3;
+	partial_data5 = (int64_t)((int64_t)(partial_data2 * 262144) + partial_data4);
+	partial_data6 = (int64_t)(partial_data5 / 4294967296);
+	int64_t t_lin = partial_data6;
+	int64_t comp_temp = (int64_t)((partial_data6 * 25) / 16384);
+
+	/* compensate_pressure */
+	int64_t offset, sensitivity;
+	uint64_t comp_press;
+	partial_data1 = t_lin * t_lin;
+	partial_data2 = partial_data1 / 64;
+	partial_data3 = (partial_data2 * t_lin) / 256;
+	partial_data4 = (par_p8 * partial_data3) / 32;
+	partial_data5 = (par_p7 * partial_data1) * 16;
+	partial_data6 = (par_p6 * t_lin) * 4194304;
+	offset = (par_p5 * 140737488355328) + partial_data4 + partial_data5 + partial_data6;
+	partial_data2 = (par_p4 * partial_data3) / 32;
+	partial_data4 = (par_p3 * partial_data1) * 4;
+	partial_data5 = (par_p2 - 16384) * t_lin * 2097152;
+	sensitivity = ((par_p1 - 16384) * 70368744177664) + partial_data2 + partial_data4 + partial_data5;
+	partial_data1 = (sensitivity / 16777216) * up;
+	partial_data2 = par_p10 * t_lin;
+	partial_data3 = partial_data2 + (65536 * par_p9);
+	partial_data4 = (partial_data3 * up) / 8192;
+	partial_data5 = (partial_data4 * up) / 512;
+	partial_data6 = (int64_t)((uint64_t)up * (uint64_t)up);
+	partial_data2 = (par_p11 * partial_data6) / 65536;
+	partial_data3 = (partial_data2 * up) / 128;
+	partial_data4 = (offset / 4) + partial_data1 + partial_data5 + partial_data3;
+	comp_press = (((uint64_t)partial_data4 * 25) / (uint64_t)1099511627776);
+
+	/* datasheet chapter 9.1: quantization of coefficients */
+	double q_t1 = par_t1 / pow(2, -8), q_t2 = par_t2 / pow(2, 30), q_t3 = par_t3 / pow(2, 48);
+	double q_p1 = (par_p1 - pow(2, 14)) / pow(2, 20), q_p2 = (par_p2 - pow(2, 14)) / pow(2, 29);
+	double q_p3 = par_p3 / pow(2, 32), q_p4 = par_p4 / pow(2, 37);
+	double q_p5 = par_p5 / pow(2, -3), q_p6 = par_p6 / pow(2, 6);
+	double q_p7 = par_p7 / pow(2, 8), q_p8 = par_p8 / pow(2, 15);
+	double q_p9 = par_p9 / pow(2, 48), q_p10 = par_p10 / pow(2, 48), q_p11 = par_p11 / pow(2, 65);
+
+	/* datasheet chapter 9.2 and 9.3 */
+	double d1 = (double)ut - q_t1;
+	double d2 = d1 * q_t2;
+	double t_lin_d = d2 + (d1 * d1) * q_t3;
+	double o1 = q_p5 + q_p6 * t_lin_d + q_p7 * t_lin_d * t_lin_d + q_p8 * t_lin_d * t_lin_d * t_lin_d;
+	double o2 = (double)up * (q_p1 + q_p2 * t_lin_d + q_p3 * t_lin_d * t_lin_d +
+		    q_p4 * t_lin_d * t_lin_d * t_lin_d);
+	double p2 = (double)up * (double)up;
+	double o3 = p2 * (q_p9 + q_p10 * t_lin_d) + p2 * (double)up * q_p11;
+	double press_d = o1 + o2 + o3;
+
+	printf("BMP388 ut=%u up=%u: temperature %lld/100, pressure %llu/100, double %.6f %.6f\n",
+	       ut, up, (long long)comp_temp, (unsigned long long)comp_press, t_lin_d, press_d);
+}
+
+int main(void)
+{
+	/* BMP280 datasheet example calibration with humidity block of simulator */
+	const uint8_t bme[] = {
+		0x70, 0x6B, 0x43, 0x67, 0x18, 0xFC, 0x7D, 0x8E, 0x43, 0xD6,
+		0xD0, 0x0B, 0x27, 0x0B, 0x8C, 0x00, 0xF9, 0xFF, 0x8C, 0x3C,
+		0xF8, 0xC6, 0x70, 0x17, 0x4B, 0x6A, 0x01, 0x00, 0x13, 0x29,
+		0x03, 0x1E,
+	};
+	const uint8_t bme_neg[] = {
+		0x70, 0x6B, 0x43, 0x67, 0x18, 0xFC, 0x7D, 0x8E, 0x43, 0xD6,
+		0xD0, 0x0B, 0x27, 0x0B, 0x8C, 0x00, 0xF9, 0xFF, 0x8C, 0x3C,
+		0xF8, 0xC6, 0x70, 0x17, 0x4B, 0x6A, 0x01, 0x00, 0xFF, 0x29,
+		0xFE, 0x1E,
+	};
+	const uint8_t bmp388c[] = {
+		0x7C, 0x6C, 0x04, 0x4B, 0xF9, 0x73, 0xFB, 0xCC, 0xF4, 0x23,
+		0x01, 0x0E, 0x60, 0xDF, 0x74, 0x03, 0xFB, 0x2A, 0x3A, 0x05,
+		0xC4,
+	};
+	bme280(bme, 519888, 30000);
+	bme280(bme_neg, 519888, 10000);
+	bmp388(bmp388c, 8382464, 6212880);
+	bmp388(bmp388c, 8100000, 6700000);
+	return 0;
+}
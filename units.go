@@ -0,0 +1,217 @@
+//--------------------------------------------------------------------------------------------------
+//
+// Copyright (c) 2018 Denis Dyakov
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and
+// associated documentation files (the "Software"), to deal in the Software without restriction,
+// including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial
+// portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING
+// BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+// NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+//--------------------------------------------------------------------------------------------------
+
+package bsbmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// PressureUnit is a unit of pressure measurement.
+type PressureUnit int
+
+const (
+	PRESSURE_PA PressureUnit = iota
+	PRESSURE_HPA
+	PRESSURE_KPA
+	PRESSURE_MMHG
+	PRESSURE_INHG
+	PRESSURE_MBAR
+	PRESSURE_ATM
+	PRESSURE_PSI
+)
+
+// pressureUnits keeps unit symbol and amount of Pa in unit.
+var pressureUnits = map[PressureUnit]struct {
+	symbol string
+	pascal float64
+}{
+	PRESSURE_PA:   {"Pa", 1},
+	PRESSURE_HPA:  {"hPa", 100},
+	PRESSURE_KPA:  {"kPa", 1000},
+	PRESSURE_MMHG: {"mmHg", 133.322387415},
+	PRESSURE_INHG: {"inHg", 3386.389},
+	PRESSURE_MBAR: {"mbar", 100},
+	PRESSURE_ATM:  {"atm", 101325},
+	PRESSURE_PSI:  {"psi", 6894.757293168},
+}
+
+// String returns unit symbol.
+func (v PressureUnit) String() string {
+	if u, ok := pressureUnits[v]; ok {
+		return u.symbol
+	}
+	return "!!! unknown !!!"
+}
+
+// TemperatureUnit is a unit of temperature measurement.
+type TemperatureUnit int
+
+const (
+	TEMPERATURE_C TemperatureUnit = iota
+	TEMPERATURE_F
+	TEMPERATURE_K
+)
+
+// String returns unit symbol.
+func (v TemperatureUnit) String() string {
+	switch v {
+	case TEMPERATURE_C:
+		return "°C"
+	case TEMPERATURE_F:
+		return "°F"
+	case TEMPERATURE_K:
+		return "K"
+	default:
+		return "!!! unknown !!!"
+	}
+}
+
+// LengthUnit is a unit of altitude and height measurement.
+type LengthUnit int
+
+const (
+	LENGTH_M LengthUnit = iota
+	LENGTH_FT
+)
+
+// String returns unit symbol.
+func (v LengthUnit) String() string {
+	switch v {
+	case LENGTH_M:
+		return "m"
+	case LENGTH_FT:
+		return "ft"
+	default:
+		return "!!! unknown !!!"
+	}
+}
+
+// Pressure is a pressure value in Pa (Pascal).
+type Pressure float64
+
+// In converts pressure to unit. Unknown unit gives NaN.
+func (v Pressure) In(unit PressureUnit) float64 {
+	u, ok := pressureUnits[unit]
+	if !ok {
+		return math.NaN()
+	}
+	return float64(v) / u.pascal
+}
+
+// Format returns pressure converted to unit along with unit symbol,
+// with specified amount of digits after decimal point.
+func (v Pressure) Format(unit PressureUnit, prec int) string {
+	return fmt.Sprintf("%.*f %v", prec, v.In(unit), unit)
+}
+
+// PressureFrom converts value in unit to pressure.
+func PressureFrom(value float64, unit PressureUnit) Pressure {
+	u, ok := pressureUnits[unit]
+	if !ok {
+		return Pressure(math.NaN())
+	}
+	return Pressure(value * u.pascal)
+}
+
+// Temperature is a temperature value in C (celsius).
+type Temperature float64
+
+// In converts temperature to unit. Unknown unit gives NaN.
+func (v Temperature) In(unit TemperatureUnit) float64 {
+	switch unit {
+	case TEMPERATURE_C:
+		return float64(v)
+	case TEMPERATURE_F:
+		return float64(v)*9/5 + 32
+	case TEMPERATURE_K:
+		return float64(v) + kelvinOffset
+	default:
+		return math.NaN()
+	}
+}
+
+// Format returns temperature converted to unit along with unit symbol,
+// with specified amount of digits after decimal point.
+func (v Temperature) Format(unit TemperatureUnit, prec int) string {
+	return fmt.Sprintf("%.*f %v", prec, v.In(unit), unit)
+}
+
+// TemperatureFrom converts value in unit to temperature.
+func TemperatureFrom(value float64, unit TemperatureUnit) Temperature {
+	switch unit {
+	case TEMPERATURE_C:
+		return Temperature(value)
+	case TEMPERATURE_F:
+		return Temperature((value - 32) * 5 / 9)
+	case TEMPERATURE_K:
+		return Temperature(value - kelvinOffset)
+	default:
+		return Temperature(math.NaN())
+	}
+}
+
+// Amount of metres in foot.
+const metresInFoot = 0.3048
+
+// Length is an altitude or height value in metres.
+type Length float64
+
+// In converts length to unit. Unknown unit gives NaN.
+func (v Length) In(unit LengthUnit) float64 {
+	switch unit {
+	case LENGTH_M:
+		return float64(v)
+	case LENGTH_FT:
+		return float64(v) / metresInFoot
+	default:
+		return math.NaN()
+	}
+}
+
+// Format returns length converted to unit along with unit symbol,
+// with specified amount of digits after decimal point.
+func (v Length) Format(unit LengthUnit, prec int) string {
+	return fmt.Sprintf("%.*f %v", prec, v.In(unit), unit)
+}
+
+// LengthFrom converts value in unit to length.
+func LengthFrom(value float64, unit LengthUnit) Length {
+	switch unit {
+	case LENGTH_M:
+		return Length(value)
+	case LENGTH_FT:
+		return Length(value * metresInFoot)
+	default:
+		return Length(math.NaN())
+	}
+}
+
+// TemperatureIn returns measured temperature converted to unit.
+func (v *Measurement) TemperatureIn(unit TemperatureUnit) float64 {
+	return Temperature(v.Temperature).In(unit)
+}
+
+// PressureIn returns measured pressure converted to unit.
+func (v *Measurement) PressureIn(unit PressureUnit) float64 {
+	return Pressure(v.Pressure).In(unit)
+}
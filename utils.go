@@ -23,11 +23,11 @@ package bsbmp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"time"
-
-	i2c "github.com/d2r2/go-i2c"
 )
 
 // Utility functions
@@ -63,32 +63,83 @@ func getU16LE(buf []byte) uint16 {
 // checkCoefficient verify that compensation parameter looks valid.
 func checkCoefficient(coef uint16, name string) error {
 	if coef == 0 || coef == 0xFFFF {
-		return fmt.Errorf("Coefficient %s is invalid: 0x%X", name, coef)
+		return &ErrInvalidCalibration{Field: name, Value: coef}
 	}
 	return nil
 }
 
+// checkCoefficientBlock verify that block of coefficients, which
+// might be zero one by one, is not entirely cleared or set.
+func checkCoefficientBlock(data []byte, name string) error {
+	for _, blank := range []byte{0x00, 0xFF} {
+		n := 0
+		for _, b := range data {
+			if b == blank {
+				n++
+			}
+		}
+		if n == len(data) {
+			return &ErrInvalidCalibration{Field: name, Value: uint16(blank)<<8 | uint16(blank)}
+		}
+	}
+	return nil
+}
+
+// selectStandby returns index of longest standby time from the table,
+// which doesn't exceed requested one, otherwise index of shortest.
+func selectStandby(table []time.Duration, standby time.Duration) byte {
+	best, shortest := -1, 0
+	for i, t := range table {
+		if t <= standby && (best == -1 || t > table[best]) {
+			best = i
+		}
+		if t < table[shortest] {
+			shortest = i
+		}
+	}
+	if best == -1 {
+		best = shortest
+	}
+	return byte(best)
+}
+
 // waitForCompletion Wait until sensor completes measurements and calculations,
-// otherwise return on timeout.
-func waitForCompletion(sensor SensorInterface, i2c *i2c.I2C) (timeout bool, err error) {
-	for i := 0; i < 10; i++ {
-		flag, err := sensor.IsBusy(i2c)
+// otherwise return on timeout. Expected time is maximum conversion time
+// from sensor specification, so status is checked only when it's over.
+// Sensor is given twice as much time to complete, before ErrConversionTimeout
+// is reported. Cancellation and deadline of context are respected.
+func waitForCompletion(ctx context.Context, sensor SensorInterface, bus Bus,
+	expected time.Duration) error {
+	start := time.Now()
+	timeout := 2*expected + 10*time.Millisecond
+	delay := expected
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		flag, err := sensor.IsBusy(bus)
 		if err != nil {
-			return false, err
+			return err
 		}
 		if flag == false {
-			return false, nil
+			return nil
 		}
-		time.Sleep(5 * time.Millisecond)
+		waited := time.Since(start)
+		if waited > timeout {
+			return &ErrConversionTimeout{Expected: expected, Waited: waited}
+		}
+		delay = time.Millisecond
 	}
-	return true, nil
 }
 
-// Read byte block from i2c device to struct object.
-func readDataToStruct(i2c *i2c.I2C, byteCount int,
+// Read byte block starting from register to struct object.
+func readDataToStruct(bus Bus, reg byte, byteCount int,
 	byteOrder binary.ByteOrder, obj interface{}) error {
-	buf1 := make([]byte, byteCount)
-	_, err := i2c.ReadBytes(buf1)
+	buf1, err := bus.ReadRegBytes(reg, byteCount)
 	if err != nil {
 		return err
 	}
@@ -99,3 +150,94 @@ func readDataToStruct(i2c *i2c.I2C, byteCount int,
 	}
 	return nil
 }
+
+// selectMeasureConfig returns oversampling settings applied to conversion:
+// config set by SetMeasureConfig, if any, otherwise default one.
+func selectMeasureConfig(config *MeasureConfig, def MeasureConfig) MeasureConfig {
+	if config != nil {
+		return *config
+	}
+	return def
+}
+
+// checkMeasureConfig verify that oversampling of each channel
+// falls within range supported by sensor.
+func checkMeasureConfig(sensorType SensorType, config *MeasureConfig,
+	temperature, pressure, humidity [2]Oversampling) error {
+	channels := []struct {
+		name   string
+		value  Oversampling
+		limits [2]Oversampling
+	}{
+		{"temperature", config.Temperature, temperature},
+		{"pressure", config.Pressure, pressure},
+		{"humidity", config.Humidity, humidity},
+	}
+	for _, ch := range channels {
+		if ch.value < ch.limits[0] || ch.value > ch.limits[1] {
+			return fmt.Errorf("%s oversampling %v is %w by %v",
+				ch.name, ch.value, ErrNotSupported, sensorType)
+		}
+	}
+	return nil
+}
+
+// errSkipped returns error reported on attempt to read
+// quantity, which measurement is skipped.
+func errSkipped(quantity string) error {
+	return fmt.Errorf("%s %w by oversampling config", quantity, ErrMeasurementSkipped)
+}
+
+// Operating range of sensors, according to specification.
+// Compensated values outside of range are considered as invalid.
+const (
+	minTemperatureC = -40
+	maxTemperatureC = 85
+	minPressurePa   = 30000
+	// BMP180, BMP280 and BME280 upper limit
+	maxPressurePa = 110000
+	// BMP388 upper limit
+	maxPressureBMP388Pa = 125000
+)
+
+// checkRaw verify that uncompensated value fits ADC resolution.
+func checkRaw(quantity string, raw int32, bits uint) error {
+	if raw < 0 || raw >= 1<<bits {
+		return &ErrOutOfRange{Quantity: "raw " + quantity, Value: float64(raw),
+			Min: 0, Max: float64(int32(1)<<bits - 1)}
+	}
+	return nil
+}
+
+// checkRange verify that compensated value falls within sensor operating range.
+func checkRange(quantity string, value, min, max float64) error {
+	// Negated comparison catch NaN as well
+	if !(value >= min && value <= max) {
+		return &ErrOutOfRange{Quantity: quantity, Value: value, Min: min, Max: max}
+	}
+	return nil
+}
+
+// mulInt64 multiply numbers, reporting false on overflow.
+func mulInt64(a, b int64) (int64, bool) {
+	c := a * b
+	if a != 0 && (c/a != b || (a == -1 && b == math.MinInt64)) {
+		return 0, false
+	}
+	return c, true
+}
+
+// addInt64 sum numbers, reporting false on overflow.
+func addInt64(a, b int64) (int64, bool) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, false
+	}
+	return c, true
+}
+
+// errOverflow returns error reported, when compensation formulas
+// overflow or divide by zero with given calibration and raw values.
+func errOverflow(quantity string, min, max float64) error {
+	return &ErrOutOfRange{Quantity: quantity, Value: math.Inf(1), Min: min, Max: max}
+}